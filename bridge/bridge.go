@@ -9,15 +9,60 @@ import (
 	"github.com/upccup/july/db"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+)
+
+const (
+	ModeBridge   = "bridge"
+	ModeMacvlan  = "macvlan"
+	ModeIPvlanL2 = "ipvlan-l2"
+	ModeIPvlanL3 = "ipvlan-l3"
 )
 
 type IPConfig struct {
 	Subnet  string
 	Gateway string
+	// Network and Mode are recorded once create-network ran on the host,
+	// Parent and ShimRange too when it set up a macvlan shim
+	Network   string `json:",omitempty"`
+	Mode      string `json:",omitempty"`
+	Parent    string `json:",omitempty"`
+	ShimRange string `json:",omitempty"`
+}
+
+// HostInfo is the inventory view of a host: its network config and whether
+// the host has been assigned by create-network
+type HostInfo struct {
+	IP       string
+	Assigned bool
+	IPConfig
+}
+
+// NetworkOptions describes how the docker network of a host is plumbed.
+// Parent is the host NIC used by macvlan/ipvlan, it defaults to the
+// interface of the default route. ShimRange is the container address range
+// routed through the macvlan shim interface so the host can reach its
+// containers.
+type NetworkOptions struct {
+	Mode      string
+	Parent    string
+	ShimRange string
+}
+
+func ValidMode(mode string) bool {
+	switch mode {
+	case ModeBridge, ModeMacvlan, ModeIPvlanL2, ModeIPvlanL3:
+		return true
+	}
+
+	return false
 }
 
 func AddHostIP(ip, subnet, gateway string) error {
-	ipConfig := IPConfig{Subnet: subnet, Gateway: gateway}
+	return setConfig(ip, &IPConfig{Subnet: subnet, Gateway: gateway})
+}
+
+func setConfig(ip string, ipConfig *IPConfig) error {
 	configBytes, err := json.Marshal(ipConfig)
 	if err != nil {
 		return err
@@ -30,6 +75,83 @@ func AddHostIP(ip, subnet, gateway string) error {
 	return nil
 }
 
+func ListHosts() ([]*HostInfo, error) {
+	hostNodes, err := db.GetKeys(config.HostIPConfigStorePath)
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var hosts []*HostInfo
+	for _, hostNode := range hostNodes {
+		ip := filepath.Base(hostNode.Key)
+		host := &HostInfo{IP: ip, Assigned: checkIPAssigned(ip)}
+		if err := json.Unmarshal([]byte(hostNode.Value), &host.IPConfig); err != nil {
+			log.Warnf("host %s has a broken config %s. Error: %s", ip, hostNode.Value, err.Error())
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
+
+func GetHost(ip string) (*HostInfo, error) {
+	ipConfig, err := getConfig(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HostInfo{IP: ip, Assigned: checkIPAssigned(ip), IPConfig: *ipConfig}, nil
+}
+
+// UpdateHost changes the subnet and/or gateway of a host, empty values are
+// left untouched. A host which already created its network has to recreate
+// it for the change to take effect.
+func UpdateHost(ip, subnet, gateway string) (*HostInfo, error) {
+	ipConfig, err := getConfig(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if subnet != "" {
+		ipConfig.Subnet = subnet
+	}
+
+	if gateway != "" {
+		ipConfig.Gateway = gateway
+	}
+
+	if err := setConfig(ip, ipConfig); err != nil {
+		return nil, err
+	}
+
+	assigned := checkIPAssigned(ip)
+	if assigned {
+		log.Warnf("host %s already created network %s, recreate it to apply the new config", ip, ipConfig.Network)
+	}
+
+	return &HostInfo{IP: ip, Assigned: assigned, IPConfig: *ipConfig}, nil
+}
+
+// RemoveHost deletes both the config and the assigned marker of a host
+func RemoveHost(ip string) error {
+	if checkIPAssigned(ip) {
+		if err := db.DeleteKey(filepath.Join(config.HostAssignedIPStorePath, ip)); err != nil {
+			return err
+		}
+	}
+
+	if err := db.DeleteKey(config.GetHostIPConfigStorePath(ip)); err != nil {
+		return err
+	}
+
+	log.Infof("Remove host %s", ip)
+	return nil
+}
+
 func getConfig(ip string) (*IPConfig, error) {
 	config, err := db.GetKey(config.GetHostIPConfigStorePath(ip))
 	if err != nil {
@@ -71,10 +193,37 @@ func ReleaseHost(ip string) error {
 	return nil
 }
 
-func CreateNetwork(ip, networkName string) {
+// RestoreShim sets up the macvlan shim of a host again from its config, the
+// system doesn't keep it across reboots
+func RestoreShim(ip string) error {
+	config, err := getConfig(ip)
+	if err != nil {
+		return err
+	}
+
+	if config.Mode != ModeMacvlan || config.ShimRange == "" {
+		return nil
+	}
+
+	if config.Parent == "" {
+		_, config.Parent, _ = get_network_information()
+	}
+
+	return configure_shim(ip, config.Parent, config.ShimRange)
+}
+
+func CreateNetwork(ip, networkName string, opts NetworkOptions) {
 	var config *IPConfig
 	var err error
 
+	if opts.Mode == "" {
+		opts.Mode = ModeBridge
+	}
+
+	if !ValidMode(opts.Mode) {
+		log.Fatalf("unsupported network mode %s", opts.Mode)
+	}
+
 	if config, err = getConfig(ip); err != nil {
 		log.Fatal(err)
 	}
@@ -83,10 +232,30 @@ func CreateNetwork(ip, networkName string) {
 		log.Fatal(err)
 	}
 
-	if err = createBridge(ip, config.Subnet, config.Gateway, networkName); err != nil {
+	if opts.Mode != ModeBridge {
+		err = createVlanNetwork(ip, config.Subnet, config.Gateway, networkName, opts)
+	} else {
+		err = createBridge(ip, config.Subnet, config.Gateway, networkName)
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	config.Network, config.Mode = networkName, opts.Mode
+	if opts.Mode == ModeMacvlan {
+		config.Parent, config.ShimRange = opts.Parent, opts.ShimRange
+	}
+
+	if err = setConfig(ip, config); err != nil {
+		log.Error("record network of host failed. Error: ", err)
+	}
+
+	if opts.Mode != ModeBridge {
+		log.Infof("Create %s network on ip:%s done", opts.Mode, ip)
+		return
+	}
+
 	// TODO(upccup): now restart network maybe make network donot work, after find the reason and
 	// fix it this will work again
 	//if err = restart_network(); err != nil {
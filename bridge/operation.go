@@ -1,8 +1,10 @@
 package bridge
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
@@ -12,6 +14,9 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
+// ShimInterface is the macvlan interface the host uses to reach its containers
+const ShimInterface = "july-shim"
+
 func createBridge(ip, subnet, gateway, networkName string) error {
 	if err := create_network(ip, subnet, gateway, networkName); err != nil {
 		return err
@@ -92,6 +97,103 @@ func configure_network(ip, subnet, gateway string) error {
 	return nil
 }
 
+func createVlanNetwork(ip, subnet, gateway, networkName string, opts NetworkOptions) error {
+	if opts.Parent == "" {
+		_, opts.Parent, _ = get_network_information()
+		if opts.Parent == "" {
+			return errors.New("can not find the parent interface, please set it by --parent")
+		}
+	}
+
+	if err := create_vlan_network(subnet, gateway, networkName, opts); err != nil {
+		return err
+	}
+
+	if opts.Mode != ModeMacvlan {
+		return nil
+	}
+
+	if opts.ShimRange == "" {
+		log.Warnf("no shim range given, host %s will not be able to reach its macvlan containers", ip)
+		return nil
+	}
+
+	return configure_shim(ip, opts.Parent, opts.ShimRange)
+}
+
+// create a macvlan or ipvlan docker network on the parent interface
+// still backed by the jdjr IPAM pools
+func create_vlan_network(subnet, gateway, networkName string, opts NetworkOptions) error {
+	command := "docker"
+	var driver, driverOpt string
+	switch opts.Mode {
+	case ModeMacvlan:
+		driver, driverOpt = "macvlan", "--opt=macvlan_mode=bridge "
+	case ModeIPvlanL2:
+		driver, driverOpt = "ipvlan", "--opt=ipvlan_mode=l2 "
+	case ModeIPvlanL3:
+		driver, driverOpt = "ipvlan", "--opt=ipvlan_mode=l3 "
+	default:
+		return fmt.Errorf("unsupported network mode %s", opts.Mode)
+	}
+
+	// ipvlan l3 routes through the parent itself, there is no gateway on it
+	gatewayOpt := fmt.Sprintf("--gateway=%s ", gateway)
+	if opts.Mode == ModeIPvlanL3 {
+		gatewayOpt = ""
+	}
+
+	args := fmt.Sprint("network create ",
+		"--driver=%s ",
+		"--opt=parent=%s ",
+		driverOpt,
+		"--ipam-driver=jdjr ",
+		"--subnet=%s ",
+		gatewayOpt,
+		"%s")
+
+	args = fmt.Sprintf(args, driver, opts.Parent, subnet, networkName)
+
+	out, err := exec.Command(command, strings.Split(args, " ")...).CombinedOutput()
+	if err != nil {
+		log.Error(err, string(out))
+		return err
+	}
+
+	return nil
+}
+
+// macvlan sub interfaces can not talk to their parent, so the host reaches
+// its containers through a macvlan shim on the same parent. It can be run
+// again, e.g. after a reboot or a crash half way.
+func configure_shim(ip, parent, shimRange string) error {
+	if _, _, err := net.ParseCIDR(shimRange); err != nil {
+		return err
+	}
+
+	var steps []string
+	if exec.Command("ip", "link", "show", ShimInterface).Run() != nil {
+		steps = append(steps, fmt.Sprintf("link add %s link %s type macvlan mode bridge", ShimInterface, parent))
+	}
+
+	steps = append(steps,
+		fmt.Sprintf("addr replace %s/32 dev %s", ip, ShimInterface),
+		fmt.Sprintf("link set %s up", ShimInterface),
+		fmt.Sprintf("route replace %s dev %s", shimRange, ShimInterface),
+	)
+
+	for _, args := range steps {
+		out, err := exec.Command("ip", strings.Split(args, " ")...).CombinedOutput()
+		if err != nil {
+			log.Errorf("ip %s failed: %s", args, string(out))
+			return err
+		}
+	}
+
+	log.Infof("configure shim %s on %s for %s done", ShimInterface, parent, shimRange)
+	return nil
+}
+
 func restart_network() error {
 	command := "systemctl"
 
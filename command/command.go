@@ -1,17 +1,20 @@
 package command
 
 import (
+	_ "expvar"
 	"fmt"
 	"net"
-	"path/filepath"
+	"net/http"
+	"strconv"
 
 	"github.com/upccup/july/bridge"
-	"github.com/upccup/july/config"
-	"github.com/upccup/july/db"
 	dns "github.com/upccup/july/dns-handler"
+	dnsserver "github.com/upccup/july/dns-server"
 	docker "github.com/upccup/july/docker-client"
 	event "github.com/upccup/july/docker-event"
 	"github.com/upccup/july/ipamdriver"
+	"github.com/upccup/july/networkdriver"
+	"github.com/upccup/july/webhook"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -21,26 +24,216 @@ func NewServerCommand() cli.Command {
 	return cli.Command{
 		Name:  "server",
 		Usage: "start the IPAM plugin server& add docker event listener",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
-				Name:  "docker-endpoint",
-				Value: "tcp://127.0.0.1:2376",
-				Usage: "the docker daemon endpoint. [$DOCKER_ENDPOINT]",
+				Name:   "docker-endpoint",
+				Value:  "tcp://127.0.0.1:2376",
+				Usage:  "the docker daemon endpoint",
+				EnvVar: "JULY_DOCKER_ENDPOINT,DOCKER_ENDPOINT",
+			},
+			cli.BoolFlag{
+				Name:   "dns-ptr",
+				Usage:  "also publish the in-addr.arpa/ip6.arpa PTR record of every container address",
+				EnvVar: "JULY_DNS_PTR",
 			},
 			cli.StringFlag{
-				Name:  "dns-endpoint",
-				Value: "http://127.0.0.1:9999",
-				Usage: "the dns console server endpoint. [$DNS_ENDPOINT]",
+				Name:   "dns-network",
+				Usage:  "publish the container ip on this docker network, by default on every network using the july ipam or network driver",
+				EnvVar: "JULY_DNS_NETWORK",
 			},
-		},
+			cli.StringFlag{
+				Name:   "label-namespace",
+				Usage:  "read the domain from <namespace>.zone, <namespace>.name, ... labels instead of JR_DOMAIN_*, e.g. com.example.dns",
+				EnvVar: "JULY_LABEL_NAMESPACE",
+			},
+			cli.StringFlag{
+				Name:   "dns-default-zone",
+				Usage:  "the zone of containers without a zone label, every container on a july network gets a domain then",
+				EnvVar: "JULY_DNS_DEFAULT_ZONE",
+			},
+			cli.StringFlag{
+				Name:   "dns-name-template",
+				Usage:  "the name of containers without a name label, e.g. {{.Name}}.{{.Labels.team}}, by default the container name",
+				EnvVar: "JULY_DNS_NAME_TEMPLATE",
+			},
+			cli.DurationFlag{
+				Name:   "dns-health-grace",
+				Value:  event.DefaultHealthGracePeriod,
+				Usage:  "how long a container labeled JR_DOMAIN_HEALTHCHECK may stay unhealthy before its records are withdrawn",
+				EnvVar: "JULY_DNS_HEALTH_GRACE",
+			},
+			cli.StringFlag{
+				Name:   "dns-listen",
+				Usage:  "serve the container domains over DNS on this address, e.g. :53",
+				EnvVar: "JULY_DNS_LISTEN",
+			},
+			cli.StringSliceFlag{
+				Name:   "dns-zone",
+				Usage:  "a zone the embedded dns server answers authoritatively, can be repeated",
+				EnvVar: "JULY_DNS_ZONE",
+			},
+			cli.StringSliceFlag{
+				Name:   "dns-upstream",
+				Usage:  "the resolver the embedded dns server forwards other queries to, default is from /etc/resolv.conf",
+				EnvVar: "JULY_DNS_UPSTREAM",
+			},
+			cli.BoolFlag{
+				Name:   "network-driver",
+				Usage:  "also serve the july remote network driver (docker network create -d july)",
+				EnvVar: "JULY_NETWORK_DRIVER",
+			},
+			cli.DurationFlag{
+				Name:   "dns-retry-min",
+				Value:  dns.DefaultRetryMin,
+				Usage:  "the delay before retrying a failed dns operation the first time, doubled on every failure",
+				EnvVar: "JULY_DNS_RETRY_MIN",
+			},
+			cli.DurationFlag{
+				Name:   "dns-retry-max",
+				Value:  dns.DefaultRetryMax,
+				Usage:  "the longest delay between two retries of a failed dns operation",
+				EnvVar: "JULY_DNS_RETRY_MAX",
+			},
+			cli.DurationFlag{
+				Name:   "reconcile-interval",
+				Value:  event.DefaultReconcileInterval,
+				Usage:  "how often the dns records are reconciled with the running containers, 0 only at startup",
+				EnvVar: "JULY_RECONCILE_INTERVAL",
+			},
+			cli.DurationFlag{
+				Name:   "event-replay-window",
+				Value:  event.DefaultReplayWindow,
+				Usage:  "resume the docker events from the last checkpoint if it is newer than this, reconcile otherwise",
+				EnvVar: "JULY_EVENT_REPLAY_WINDOW",
+			},
+			cli.IntFlag{
+				Name:   "event-workers",
+				Value:  event.DefaultEventWorkers,
+				Usage:  "the number of workers handling docker events, the events of one container stay in order",
+				EnvVar: "JULY_EVENT_WORKERS",
+			},
+			cli.IntFlag{
+				Name:   "event-queue-size",
+				Value:  event.DefaultEventQueueSize,
+				Usage:  "the number of docker events each worker can queue",
+				EnvVar: "JULY_EVENT_QUEUE_SIZE",
+			},
+			cli.StringFlag{
+				Name:   "event-queue-policy",
+				Value:  event.QueuePolicyBlock,
+				Usage:  "what to do with an event when its queue is full: block or drop (the next reconcile catches up)",
+				EnvVar: "JULY_EVENT_QUEUE_POLICY",
+			},
+			cli.BoolFlag{
+				Name:   "swarm-services",
+				Usage:  "publish the swarm services labeled JR_DOMAIN_ZONE under one name for all their tasks, done by the swarm leader",
+				EnvVar: "JULY_SWARM_SERVICES",
+			},
+			cli.DurationFlag{
+				Name:   "swarm-sync-interval",
+				Value:  event.DefaultServiceSyncInterval,
+				Usage:  "how often the tasks of the swarm services are polled",
+				EnvVar: "JULY_SWARM_SYNC_INTERVAL",
+			},
+			hooksFileFlag(),
+			cli.StringFlag{
+				Name:   "host-ip",
+				Usage:  "the IP create-network was run with on this host, its macvlan shim is set up again at start",
+				EnvVar: "JULY_HOST_IP",
+			},
+			cli.StringFlag{
+				Name:   "metrics-listen",
+				Usage:  "serve the expvar metrics on this address under /debug/vars, e.g. :9090",
+				EnvVar: "JULY_METRICS_LISTEN",
+			},
+		}, dnsProviderFlags()...),
 		Action: startServerAction,
 	}
 }
 
+// hooksFileFlag is shared by the server and release-ip, so both notify the
+// webhooks of the same file
+func hooksFileFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:   "hooks-file",
+		Usage:  "a json file of hooks run on the docker events they match, webhooks with events get the ip and domain events",
+		EnvVar: "JULY_HOOKS_FILE",
+	}
+}
+
+// loadHooksFile reads the hooks file and sets up the webhooks of the july
+// events, nil when there is no hooks file
+func loadHooksFile(c *cli.Context) (*event.HooksFile, error) {
+	if c.String("hooks-file") == "" {
+		return nil, nil
+	}
+
+	hooksFile, err := event.LoadHooksFile(c.String("hooks-file"))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := hooksFile.Webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := webhook.Setup(webhooks); err != nil {
+		return nil, err
+	}
+
+	return hooksFile, nil
+}
+
 func startServerAction(c *cli.Context) {
+	hooksFile, err := loadHooksFile(c)
+	if err != nil {
+		log.Fatalf("load hooks got error: %+v", err)
+		return
+	}
+
+	if c.String("host-ip") != "" {
+		if err := bridge.RestoreShim(c.String("host-ip")); err != nil {
+			log.Errorf("restore macvlan shim of host %s failed. Error: %s", c.String("host-ip"), err.Error())
+		}
+	}
+
 	// start ipam server
 	go ipamdriver.StartServer()
 
+	// start metrics server
+	if c.String("metrics-listen") != "" {
+		go func() {
+			if err := http.ListenAndServe(c.String("metrics-listen"), nil); err != nil {
+				log.Fatalf("metrics server exit. Error: %s", err.Error())
+			}
+		}()
+	}
+
+	// start network driver server
+	if c.Bool("network-driver") {
+		go networkdriver.StartServer()
+	}
+
+	// start embedded dns server
+	if c.String("dns-listen") != "" {
+		dnsServer, err := dnsserver.NewServer(dnsserver.Config{
+			Listen:    c.String("dns-listen"),
+			Zones:     c.StringSlice("dns-zone"),
+			Upstreams: c.StringSlice("dns-upstream"),
+		})
+		if err != nil {
+			log.Fatalf("create dns server got error: %+v", err)
+			return
+		}
+
+		go func() {
+			if err := dnsServer.ListenAndServe(); err != nil {
+				log.Fatalf("dns server exit. Error: %s", err.Error())
+			}
+		}()
+	}
+
 	log.Debug("docker endpoint: ", c.String("docker-endpoint"))
 	client, err := docker.NewVersionedClient(c.String("docker-endpoint"), "1.21")
 	if err != nil {
@@ -53,10 +246,76 @@ func startServerAction(c *cli.Context) {
 		return
 	}
 
-	log.Debug("dns endpoint: ", c.String("dns-endpoint"))
+	dockerInfo, err := client.Info()
+	if err != nil {
+		log.Fatalf("get docker info got error: %+v", err)
+		return
+	}
+
+	dnsProvider, err := newDNSProvider(c)
+	if err != nil {
+		log.Fatalf("create dns provider got error: %+v", err)
+		return
+	}
+
+	// every dns operation goes through the outbox so none is lost while the
+	// backend is down
+	if _, ok := dnsProvider.(*dns.NoneProvider); !ok {
+		outbox := dns.NewOutbox(dnsProvider, dockerInfo.ID)
+		outbox.RetryMin = c.Duration("dns-retry-min")
+		outbox.RetryMax = c.Duration("dns-retry-max")
+		go outbox.Run()
+		dnsProvider = outbox
+	}
+
+	queuePolicy := c.String("event-queue-policy")
+	if queuePolicy != event.QueuePolicyBlock && queuePolicy != event.QueuePolicyDrop {
+		log.Fatalf("invalid event-queue-policy argument: %s", queuePolicy)
+		return
+	}
+
+	if c.String("dns-name-template") != "" {
+		if _, err := event.ParseNameTemplate(c.String("dns-name-template")); err != nil {
+			log.Fatalf("invalid dns-name-template argument: %s", err.Error())
+			return
+		}
+	}
+
+	enablePTR := c.Bool("dns-ptr")
+	if c.Bool("dns-rfc2136-ptr") {
+		log.Warn("--dns-rfc2136-ptr is deprecated, use --dns-ptr")
+		enablePTR = true
+	}
+
 	dockerEvenListener := &event.DockerListener{
-		DockerClient: client,
-		DNSClient:    &dns.DNSClient{Endpoint: c.String("dns-endpoint")},
+		DockerClient:        client,
+		HostID:              dockerInfo.ID,
+		DNSProvider:         dnsProvider,
+		EnablePTR:           enablePTR,
+		NetworkName:         c.String("dns-network"),
+		HealthGracePeriod:   c.Duration("dns-health-grace"),
+		ReconcileInterval:   c.Duration("reconcile-interval"),
+		ReplayWindow:        c.Duration("event-replay-window"),
+		Workers:             c.Int("event-workers"),
+		QueueSize:           c.Int("event-queue-size"),
+		QueuePolicy:         queuePolicy,
+		EnableServices:      c.Bool("swarm-services"),
+		ServiceSyncInterval: c.Duration("swarm-sync-interval"),
+		DefaultZone:         c.String("dns-default-zone"),
+		NameTemplate:        c.String("dns-name-template"),
+	}
+
+	if c.String("label-namespace") != "" {
+		dockerEvenListener.LabelKeys = event.NamespacedLabelKeys(c.String("label-namespace"))
+	}
+
+	if hooksFile != nil {
+		hooks, err := hooksFile.DockerHooks()
+		if err != nil {
+			log.Fatalf("load hooks got error: %+v", err)
+			return
+		}
+		dockerEvenListener.Hooks = hooks
 	}
 	dockerEvenListener.StartListenDockerAction()
 }
@@ -124,6 +383,7 @@ func NewReleaseIPCommand() cli.Command {
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "ip", Usage: "the release IP"},
 			cli.StringFlag{Name: "subnet", Usage: "the subnet of release IP"},
+			hooksFileFlag(),
 		},
 		Action: releaseIPAction,
 	}
@@ -143,11 +403,18 @@ func releaseIPAction(c *cli.Context) {
 		return
 	}
 
+	if _, err := loadHooksFile(c); err != nil {
+		log.Fatalf("load hooks got error: %+v", err)
+		return
+	}
+
 	if err := ipamdriver.ReleaseIP(subnet, ip); err != nil {
 		log.Fatalf("release ip %s failed, Errro: %s", ip, err.Error())
 		return
 	}
 
+	// the ip.released webhooks are delivered in the background
+	webhook.Wait()
 	log.Infof("release ip %s success.", ip)
 }
 
@@ -225,6 +492,9 @@ func NewCreateNetworkCommand() cli.Command {
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "ip", Usage: "the IP docker bridge use"},
 			cli.StringFlag{Name: "name", Usage: "the docker network name"},
+			cli.StringFlag{Name: "mode", Value: bridge.ModeBridge, Usage: "the network mode: bridge, macvlan, ipvlan-l2 or ipvlan-l3"},
+			cli.StringFlag{Name: "parent", Usage: "the parent interface of macvlan/ipvlan, default is the interface of the default route"},
+			cli.StringFlag{Name: "shim-range", Usage: "the container IP range in CIDR notation the host reaches through the macvlan shim"},
 		},
 		Action: createNetworkAction,
 	}
@@ -233,7 +503,44 @@ func NewCreateNetworkCommand() cli.Command {
 func createNetworkAction(c *cli.Context) {
 	ip := c.String("ip")
 	name := c.String("name")
-	bridge.CreateNetwork(ip, name)
+	mode := c.String("mode")
+	if !bridge.ValidMode(mode) {
+		log.Errorf("invalid mode argument: %s", mode)
+		return
+	}
+
+	bridge.CreateNetwork(ip, name, bridge.NetworkOptions{
+		Mode:      mode,
+		Parent:    c.String("parent"),
+		ShimRange: c.String("shim-range"),
+	})
+}
+
+const (
+	IPStateFree     = "free"
+	IPStateAssigned = "assigned"
+
+	// OwnerHost is the owner of the ip assigned to a host
+	OwnerHost = "host"
+)
+
+// IPEntry is an address of a container pool or a host. Owner is the name of
+// the container publishing a domain on the ip, or host
+type IPEntry struct {
+	Subnet    string
+	IP        string
+	State     string
+	Owner     string `json:",omitempty"`
+	Container string `json:",omitempty"`
+	Host      string `json:",omitempty"`
+}
+
+// PoolSummary counts the free and assigned addresses of a container pool
+type PoolSummary struct {
+	Subnet   string
+	Free     int
+	Assigned int
+	Total    int
 }
 
 func NewShowAssignedIPCommand() cli.Command {
@@ -242,74 +549,233 @@ func NewShowAssignedIPCommand() cli.Command {
 		Flags: []cli.Flag{
 			cli.BoolFlag{Name: "container", Usage: "show container ip pool"},
 			cli.BoolFlag{Name: "host", Usage: "show host ip pool"},
+			cli.StringFlag{Name: "subnet", Usage: "only the ips of this subnet, e.g. 192.168.1.0/24"},
+			newOutputFlag(),
 		},
-		Usage:  "show the which has been assigned",
+		Usage:  "show the ips which have been assigned, of the containers and hosts by default",
 		Action: showAssignedIPAction,
 	}
 }
 
 func showAssignedIPAction(c *cli.Context) {
-	// show all assigned host IP
-	if c.Bool("host") {
-		hostNodes, err := db.GetKeys(config.HostAssignedIPStorePath)
+	output := c.String("output")
+	subnet := c.String("subnet")
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	if !validSubnet(subnet) {
+		log.Errorf("invalid subnet argument: %s", subnet)
+		return
+	}
+
+	showContainers, showHosts := c.Bool("container"), c.Bool("host")
+	if !showContainers && !showHosts {
+		showContainers, showHosts = true, true
+	}
+
+	var entries []*IPEntry
+	if showHosts {
+		hosts, err := bridge.ListHosts()
 		if err != nil {
 			log.Fatal("get assigned ip failed. Error: ", err)
 			return
 		}
 
-		log.Info("assgined host IP:   ")
-		for _, hostNode := range hostNodes {
-			log.Info(hostNode.Key, "  ", hostNode.Value)
+		for _, host := range hosts {
+			if !host.Assigned || (subnet != "" && !sameSubnet(subnet, host.Subnet)) {
+				continue
+			}
+
+			entries = append(entries, &IPEntry{Subnet: host.Subnet, IP: host.IP, State: IPStateAssigned, Owner: OwnerHost})
 		}
 	}
 
-	if c.Bool("container") {
-		log.Info("assigned container IP: ")
-		containerNets, err := db.GetKeys(config.ContainerIPStorePrefix)
+	if showContainers {
+		pools, err := ipamdriver.ListPools(subnet)
 		if err != nil {
-			log.Fatal("get contaienr nets failed. Error: ", err)
+			log.Fatal("get container pools failed. Error: ", err)
 			return
 		}
 
-		for _, containerNet := range containerNets {
-			assignedNodes, err := db.GetKeys(filepath.Join(containerNet.Key, "assigned"))
-			if err != nil {
-				log.Fatalf("get contaienr net %s assigned ips failed. Error: %s", containerNet.Key, err.Error())
-				return
-			}
-
-			for _, assignedNode := range assignedNodes {
-				log.Info(assignedNode.Key, "  ", assignedNode.Value)
+		owners := ipOwners()
+		for _, pool := range pools {
+			for _, ip := range pool.Assigned {
+				entries = append(entries, containerIPEntry(pool, ip, IPStateAssigned, owners))
 			}
 		}
 	}
+
+	printIPs(output, entries)
 }
 
 func NewShowIPPoolCommand() cli.Command {
 	return cli.Command{
-		Name:   "ip-pool",
-		Usage:  "show the ip poop",
+		Name:  "ip-pool",
+		Usage: "show the free ips of the container pools",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "subnet", Usage: "only the pool of this subnet, e.g. 192.168.1.0/24"},
+			cli.BoolFlag{Name: "all", Usage: "also show the assigned ips"},
+			cli.BoolFlag{Name: "summary", Usage: "show the count of free and assigned ips of every pool instead"},
+			newOutputFlag(),
+		},
 		Action: showIPPoolAction,
 	}
 }
 
 func showIPPoolAction(c *cli.Context) {
-	log.Info("container IP pool: ")
-	containerNets, err := db.GetKeys(config.ContainerIPStorePrefix)
+	output := c.String("output")
+	subnet := c.String("subnet")
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	if !validSubnet(subnet) {
+		log.Errorf("invalid subnet argument: %s", subnet)
+		return
+	}
+
+	pools, err := ipamdriver.ListPools(subnet)
 	if err != nil {
-		log.Fatal("get contaienr nets failed. Error: ", err)
+		log.Fatal("get container pools failed. Error: ", err)
 		return
 	}
 
-	for _, containerNet := range containerNets {
-		idleNodes, err := db.GetKeys(filepath.Join(containerNet.Key, "pool"))
-		if err != nil {
-			log.Fatalf("get contaienr net %s assigned ips failed. Error: %s", containerNet.Key, err.Error())
-			return
+	if c.Bool("summary") {
+		printPoolSummaries(output, pools)
+		return
+	}
+
+	var owners map[string]domainBinding
+	if c.Bool("all") {
+		owners = ipOwners()
+	}
+
+	var entries []*IPEntry
+	for _, pool := range pools {
+		for _, ip := range pool.Free {
+			entries = append(entries, containerIPEntry(pool, ip, IPStateFree, nil))
 		}
 
-		for _, idleNode := range idleNodes {
-			log.Info(idleNode.Key, "  ", idleNode.Value)
+		if c.Bool("all") {
+			for _, ip := range pool.Assigned {
+				entries = append(entries, containerIPEntry(pool, ip, IPStateAssigned, owners))
+			}
 		}
 	}
+
+	printIPs(output, entries)
+}
+
+func containerIPEntry(pool *ipamdriver.Pool, ip, state string, owners map[string]domainBinding) *IPEntry {
+	entry := &IPEntry{Subnet: pool.Subnet, IP: ip, State: state}
+	if owner, ok := owners[ip]; ok {
+		entry.Owner = owner.Name
+		entry.Container = owner.ID
+		entry.Host = owner.Host
+	}
+
+	return entry
+}
+
+// ipOwners maps the container ips to the containers publishing a domain on
+// them, the ipam store doesn't know the container of an ip
+func ipOwners() map[string]domainBinding {
+	owners := make(map[string]domainBinding)
+	infos, err := event.StoredContainerIPInfos()
+	if err != nil {
+		log.Warnf("get container domains failed, the ip owners are unknown. Error: %s", err.Error())
+		return owners
+	}
+
+	for ID, info := range infos {
+		for _, address := range info.Addresses() {
+			owners[address.IP] = domainBinding{ID: ID, ContainerIPInfo: info}
+		}
+	}
+
+	return owners
+}
+
+func printIPs(output string, entries []*IPEntry) {
+	if dataOutput(output) {
+		if entries == nil {
+			entries = []*IPEntry{}
+		}
+
+		if err := printData(output, entries); err != nil {
+			log.Error("print ips failed. Error: ", err)
+		}
+		return
+	}
+
+	var rows [][]string
+	for _, entry := range entries {
+		if output == OutputWide {
+			rows = append(rows, []string{entry.Subnet, entry.IP, entry.State, entry.Owner, entry.Container, entry.Host})
+			continue
+		}
+
+		rows = append(rows, []string{entry.Subnet, entry.IP, entry.State, entry.Owner})
+	}
+
+	if output == OutputWide {
+		printTable([]string{"SUBNET", "IP", "STATE", "OWNER", "CONTAINER", "HOST"}, rows)
+		return
+	}
+
+	printTable([]string{"SUBNET", "IP", "STATE", "OWNER"}, rows)
+}
+
+func printPoolSummaries(output string, pools []*ipamdriver.Pool) {
+	summaries := []*PoolSummary{}
+	for _, pool := range pools {
+		summaries = append(summaries, &PoolSummary{
+			Subnet:   pool.Subnet,
+			Free:     len(pool.Free),
+			Assigned: len(pool.Assigned),
+			Total:    len(pool.Free) + len(pool.Assigned),
+		})
+	}
+
+	if dataOutput(output) {
+		if err := printData(output, summaries); err != nil {
+			log.Error("print pools failed. Error: ", err)
+		}
+		return
+	}
+
+	var rows [][]string
+	for _, summary := range summaries {
+		rows = append(rows, []string{summary.Subnet, strconv.Itoa(summary.Free),
+			strconv.Itoa(summary.Assigned), strconv.Itoa(summary.Total)})
+	}
+
+	printTable([]string{"SUBNET", "FREE", "ASSIGNED", "TOTAL"}, rows)
+}
+
+// validSubnet accepts an empty subnet, a CIDR or a network address
+func validSubnet(subnet string) bool {
+	if subnet == "" || net.ParseIP(subnet) != nil {
+		return true
+	}
+
+	_, _, err := net.ParseCIDR(subnet)
+	return err == nil
+}
+
+func sameSubnet(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	_, netA, errA := net.ParseCIDR(a)
+	_, netB, errB := net.ParseCIDR(b)
+	if errA != nil || errB != nil {
+		return errA != nil && errB == nil && netB.IP.Equal(net.ParseIP(a))
+	}
+
+	return netA.String() == netB.String()
 }
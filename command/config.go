@@ -0,0 +1,397 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const secretMask = "******"
+
+// GlobalFlags are the flags of july before the command
+func GlobalFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{Name: "cluster-store", Value: "http://127.0.0.1:2379", Usage: "the key/value store endpoint url.", EnvVar: "JULY_CLUSTER_STORE,CLUSTER_STORE"},
+		cli.BoolFlag{Name: "debug", Usage: "debug mode", EnvVar: "JULY_DEBUG,DEBUG"},
+		cli.StringFlag{Name: "config", Usage: "a yaml file of settings (toml is not supported), the flags and environment variables take precedence over it", EnvVar: "JULY_CONFIG"},
+	}
+}
+
+// setting is a key of the config file and the flag it sets, of the command
+// or the global flag when Command is empty. Command is the path of a
+// subcommand, e.g. "domains list"
+type setting struct {
+	Section string
+	Key     string
+	Command string
+	Flag    string
+	Secret  bool
+}
+
+var settings = []setting{
+	{Section: "store", Key: "endpoint", Flag: "cluster-store"},
+	{Section: "log", Key: "debug", Flag: "debug"},
+
+	{Section: "docker", Key: "endpoint", Command: "server", Flag: "docker-endpoint"},
+
+	{Section: "dns", Key: "provider", Command: "server", Flag: "dns-provider"},
+	{Section: "dns", Key: "endpoint", Command: "server", Flag: "dns-endpoint"},
+	{Section: "dns", Key: "auth-scheme", Command: "server", Flag: "dns-auth-scheme"},
+	{Section: "dns", Key: "user", Command: "server", Flag: "dns-user"},
+	{Section: "dns", Key: "password", Command: "server", Flag: "dns-password", Secret: true},
+	{Section: "dns", Key: "token", Command: "server", Flag: "dns-token", Secret: true},
+	{Section: "dns", Key: "secrets-file", Command: "server", Flag: "dns-secrets-file"},
+	{Section: "dns", Key: "etcd-prefix", Command: "server", Flag: "dns-etcd-prefix"},
+	{Section: "dns", Key: "rfc2136-server", Command: "server", Flag: "dns-rfc2136-server"},
+	{Section: "dns", Key: "rfc2136-zone", Command: "server", Flag: "dns-rfc2136-zone"},
+	{Section: "dns", Key: "rfc2136-ttl", Command: "server", Flag: "dns-rfc2136-ttl"},
+	{Section: "dns", Key: "rfc2136-ptr", Command: "server", Flag: "dns-rfc2136-ptr"},
+	{Section: "dns", Key: "tsig-key", Command: "server", Flag: "dns-tsig-key"},
+	{Section: "dns", Key: "tsig-secret", Command: "server", Flag: "dns-tsig-secret", Secret: true},
+	{Section: "dns", Key: "tsig-algorithm", Command: "server", Flag: "dns-tsig-algorithm"},
+	{Section: "dns", Key: "ptr", Command: "server", Flag: "dns-ptr"},
+	{Section: "dns", Key: "network", Command: "server", Flag: "dns-network"},
+	{Section: "dns", Key: "label-namespace", Command: "server", Flag: "label-namespace"},
+	{Section: "dns", Key: "default-zone", Command: "server", Flag: "dns-default-zone"},
+	{Section: "dns", Key: "name-template", Command: "server", Flag: "dns-name-template"},
+	{Section: "dns", Key: "health-grace", Command: "server", Flag: "dns-health-grace"},
+	{Section: "dns", Key: "retry-min", Command: "server", Flag: "dns-retry-min"},
+	{Section: "dns", Key: "retry-max", Command: "server", Flag: "dns-retry-max"},
+	{Section: "dns", Key: "listen", Command: "server", Flag: "dns-listen"},
+	{Section: "dns", Key: "zone", Command: "server", Flag: "dns-zone"},
+	{Section: "dns", Key: "upstream", Command: "server", Flag: "dns-upstream"},
+
+	{Section: "ipam", Key: "network-driver", Command: "server", Flag: "network-driver"},
+
+	{Section: "bridge", Key: "ip", Command: "create-network", Flag: "ip"},
+	{Section: "bridge", Key: "name", Command: "create-network", Flag: "name"},
+	{Section: "bridge", Key: "mode", Command: "create-network", Flag: "mode"},
+	{Section: "bridge", Key: "parent", Command: "create-network", Flag: "parent"},
+	{Section: "bridge", Key: "shim-range", Command: "create-network", Flag: "shim-range"},
+	{Section: "bridge", Key: "host-ip", Command: "server", Flag: "host-ip"},
+
+	{Section: "events", Key: "reconcile-interval", Command: "server", Flag: "reconcile-interval"},
+	{Section: "events", Key: "replay-window", Command: "server", Flag: "event-replay-window"},
+	{Section: "events", Key: "workers", Command: "server", Flag: "event-workers"},
+	{Section: "events", Key: "queue-size", Command: "server", Flag: "event-queue-size"},
+	{Section: "events", Key: "queue-policy", Command: "server", Flag: "event-queue-policy"},
+	{Section: "events", Key: "hooks-file", Command: "server", Flag: "hooks-file"},
+
+	{Section: "swarm", Key: "services", Command: "server", Flag: "swarm-services"},
+	{Section: "swarm", Key: "sync-interval", Command: "server", Flag: "swarm-sync-interval"},
+
+	{Section: "metrics", Key: "listen", Command: "server", Flag: "metrics-listen"},
+
+	{Section: "cli", Key: "output", Command: "ip-pool", Flag: "output"},
+}
+
+// allSettings is the settings table followed by a setting for every other
+// flag of the commands, in the section named after the command, e.g.
+// ip-range.ip-start or domains-list.zone. Flags sharing the environment
+// variable of a setting, like the output of the read commands, are left out.
+func allSettings() []setting {
+	all := append([]setting(nil), settings...)
+	envVars := make(map[string]bool)
+	for _, s := range all {
+		if def, err := settingFlag(s); err == nil {
+			envVars[flagEnvVar(def)] = true
+		}
+	}
+
+	var walk func(path string, commands []cli.Command)
+	walk = func(path string, commands []cli.Command) {
+		for _, command := range commands {
+			name := strings.TrimSpace(path + " " + command.Name)
+			for _, f := range command.Flags {
+				if envVars[flagEnvVar(f)] {
+					continue
+				}
+				envVars[flagEnvVar(f)] = true
+
+				all = append(all, setting{
+					Section: strings.Replace(name, " ", "-", -1),
+					Key:     flagName(f),
+					Command: name,
+					Flag:    flagName(f),
+				})
+			}
+			walk(name, command.Subcommands)
+		}
+	}
+	walk("", Commands())
+
+	return all
+}
+
+func NewConfigCommand() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "inspect the july settings",
+		Subcommands: []cli.Command{
+			{
+				Name:  "show",
+				Usage: "print the effective settings, from the flags, environment variables, config file and defaults",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "output, o", Value: OutputYAML, Usage: "the output format: yaml or json"},
+				},
+				Action: showConfigAction,
+			},
+		},
+	}
+}
+
+func showConfigAction(c *cli.Context) {
+	output := c.String("output")
+	if output != OutputYAML && output != OutputJSON {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	var sections yaml.MapSlice
+	values := make(map[string]yaml.MapSlice)
+	for _, s := range allSettings() {
+		value, err := settingValue(c, s)
+		if err != nil {
+			log.Fatal("get config failed. Error: ", err)
+			return
+		}
+
+		if s.Secret && value != "" {
+			value = secretMask
+		}
+
+		if _, ok := values[s.Section]; !ok {
+			sections = append(sections, yaml.MapItem{Key: s.Section})
+		}
+		values[s.Section] = append(values[s.Section], yaml.MapItem{Key: s.Key, Value: value})
+	}
+
+	if output == OutputJSON {
+		config := make(map[string]map[string]interface{})
+		for section, items := range values {
+			config[section] = make(map[string]interface{})
+			for _, item := range items {
+				config[section][item.Key.(string)] = item.Value
+			}
+		}
+
+		if err := printJSON(config); err != nil {
+			log.Error("print config failed. Error: ", err)
+		}
+		return
+	}
+
+	for i := range sections {
+		sections[i].Value = values[sections[i].Key.(string)]
+	}
+
+	if err := printYAML(sections); err != nil {
+		log.Error("print config failed. Error: ", err)
+	}
+}
+
+// LoadConfigFile reads the settings of the --config file. A setting only
+// applies when neither its flag nor its environment variable is set, so the
+// precedence is flag, environment variable, config file and default
+func LoadConfigFile(c *cli.Context) error {
+	path := c.GlobalString("config")
+	if path == "" {
+		return nil
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		return fmt.Errorf("config file %s: toml is not supported, use yaml", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse config file %s failed: %s", path, err.Error())
+	}
+
+	for section, keys := range file {
+		for key, value := range keys {
+			s, ok := findSetting(section, key)
+			if !ok {
+				return fmt.Errorf("unknown setting %s.%s in config file %s", section, key, path)
+			}
+
+			if value == nil {
+				continue
+			}
+
+			def, err := settingFlag(s)
+			if err != nil {
+				return err
+			}
+
+			// the environment variables of the flags are read when the
+			// command runs, the file fills the ones left empty
+			envVars := flagEnvVar(def)
+			if _, ok := lookupEnv(envVars); ok {
+				continue
+			}
+
+			envVar := strings.TrimSpace(strings.Split(envVars, ",")[0])
+			if err := os.Setenv(envVar, settingString(value)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GlobalString is c.GlobalString including the value of the config file
+func GlobalString(c *cli.Context, name string) string {
+	value, err := globalValue(c, name)
+	if err != nil {
+		log.Errorf("get global flag %s failed. Error: %s", name, err.Error())
+		return c.GlobalString(name)
+	}
+
+	return value.String()
+}
+
+// GlobalBool is c.GlobalBool including the value of the config file
+func GlobalBool(c *cli.Context, name string) bool {
+	value, err := globalValue(c, name)
+	if err != nil {
+		log.Errorf("get global flag %s failed. Error: %s", name, err.Error())
+		return c.GlobalBool(name)
+	}
+
+	if getter, ok := value.(flag.Getter); ok {
+		b, _ := getter.Get().(bool)
+		return b
+	}
+
+	return false
+}
+
+// globalValue applies a global flag again when it isn't set on the command
+// line, as the config file may have set its environment variable since the
+// flags were parsed
+func globalValue(c *cli.Context, name string) (flag.Value, error) {
+	if c.GlobalIsSet(name) {
+		if value, ok := c.GlobalGeneric(name).(flag.Value); ok {
+			return value, nil
+		}
+	}
+
+	return applyFlag(setting{Flag: name})
+}
+
+// settingValue is the effective value of a setting, as printed by config show
+func settingValue(c *cli.Context, s setting) (interface{}, error) {
+	var value flag.Value
+	var err error
+	if s.Command == "" {
+		value, err = globalValue(c, s.Flag)
+	} else {
+		value, err = applyFlag(s)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case *cli.StringSlice:
+		if v.Value() == nil {
+			return []string{}, nil
+		}
+		return v.Value(), nil
+	case flag.Getter:
+		if d, ok := v.Get().(time.Duration); ok {
+			return d.String(), nil
+		}
+		return v.Get(), nil
+	}
+
+	return value.String(), nil
+}
+
+// applyFlag parses the flag of a setting from its environment variables and
+// default only
+func applyFlag(s setting) (flag.Value, error) {
+	def, err := settingFlag(s)
+	if err != nil {
+		return nil, err
+	}
+
+	set := flag.NewFlagSet(s.Flag, flag.ContinueOnError)
+	def.Apply(set)
+	return set.Lookup(s.Flag).Value, nil
+}
+
+func settingFlag(s setting) (cli.Flag, error) {
+	flags := GlobalFlags()
+	if s.Command != "" {
+		command, ok := findCommand(Commands(), strings.Fields(s.Command))
+		if !ok {
+			return nil, fmt.Errorf("no command %q", s.Command)
+		}
+		flags = command.Flags
+	}
+
+	for _, f := range flags {
+		if flagName(f) == s.Flag {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no flag %s of command %q", s.Flag, s.Command)
+}
+
+// findCommand returns the command at path, e.g. [domains list]
+func findCommand(commands []cli.Command, path []string) (cli.Command, bool) {
+	for _, command := range commands {
+		if len(path) == 0 || command.Name != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			return command, true
+		}
+		return findCommand(command.Subcommands, path[1:])
+	}
+
+	return cli.Command{}, false
+}
+
+func findSetting(section, key string) (setting, bool) {
+	for _, s := range allSettings() {
+		if s.Section == section && s.Key == key {
+			return s, true
+		}
+	}
+
+	return setting{}, false
+}
+
+// settingString formats a config file value the way the flag reads it from
+// its environment variable, lists are comma separated
+func settingString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		values := make([]string, len(list))
+		for i, v := range list {
+			values[i] = fmt.Sprint(v)
+		}
+		return strings.Join(values, ",")
+	}
+
+	return fmt.Sprint(value)
+}
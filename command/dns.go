@@ -0,0 +1,179 @@
+package command
+
+import (
+	"strconv"
+	"time"
+
+	dns "github.com/upccup/july/dns-handler"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+func NewDNSCommand() cli.Command {
+	return cli.Command{
+		Name:  "dns",
+		Usage: "inspect the dns records published by july",
+		Subcommands: []cli.Command{
+			{
+				Name:  "pending",
+				Usage: "list the dns operations waiting in the outbox to be retried",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "host", Usage: "only the operations of this host (docker daemon ID)"},
+					newOutputFlag(),
+				},
+				Action: pendingDNSAction,
+			},
+		},
+	}
+}
+
+// dnsProviderFlags are the flags of the dns backend, shared by the server and
+// the commands reading the published records
+func dnsProviderFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "dns-endpoint",
+			Value:  "http://127.0.0.1:9999",
+			Usage:  "the dns console server endpoint.",
+			EnvVar: "JULY_DNS_ENDPOINT,DNS_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:   "dns-provider",
+			Value:  dns.ProviderConsole,
+			Usage:  "the dns backend: console, skydns, coredns-etcd, rfc2136 or none",
+			EnvVar: "JULY_DNS_PROVIDER",
+		},
+		cli.StringFlag{
+			Name:   "dns-auth-scheme",
+			Value:  dns.AuthSchemeMD5,
+			Usage:  "the dns console auth scheme: md5, hmac-sha256 or bearer",
+			EnvVar: "JULY_DNS_AUTH_SCHEME",
+		},
+		cli.StringFlag{
+			Name:   "dns-user",
+			Usage:  "the dns console user",
+			EnvVar: "JULY_DNS_USER,DNS_USER",
+		},
+		cli.StringFlag{
+			Name:   "dns-password",
+			Usage:  "the dns console password or hmac secret",
+			EnvVar: "JULY_DNS_PASSWORD,DNS_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "dns-token",
+			Usage:  "the dns console bearer token",
+			EnvVar: "JULY_DNS_TOKEN,DNS_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "dns-secrets-file",
+			Usage:  "a json file holding the dns console user, password and token",
+			EnvVar: "JULY_DNS_SECRETS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "dns-etcd-prefix",
+			Value:  dns.DefaultEtcdPrefix,
+			Usage:  "the key prefix of skydns/coredns-etcd records in the cluster store",
+			EnvVar: "JULY_DNS_ETCD_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "dns-rfc2136-server",
+			Usage:  "the host:port of the dns server accepting rfc2136 dynamic updates",
+			EnvVar: "JULY_DNS_RFC2136_SERVER",
+		},
+		cli.StringFlag{
+			Name:   "dns-rfc2136-zone",
+			Usage:  "the zone rfc2136 updates are sent for, default is the zone of each container",
+			EnvVar: "JULY_DNS_RFC2136_ZONE",
+		},
+		cli.IntFlag{
+			Name:   "dns-rfc2136-ttl",
+			Value:  dns.DefaultRFC2136TTL,
+			Usage:  "the ttl of records published by rfc2136 updates",
+			EnvVar: "JULY_DNS_RFC2136_TTL",
+		},
+		cli.BoolFlag{
+			Name:   "dns-rfc2136-ptr",
+			Usage:  "deprecated, use --dns-ptr which publishes the PTR records with every dns backend",
+			EnvVar: "JULY_DNS_RFC2136_PTR",
+		},
+		cli.StringFlag{
+			Name:   "dns-tsig-key",
+			Usage:  "the TSIG key name signing rfc2136 updates",
+			EnvVar: "JULY_DNS_TSIG_KEY",
+		},
+		cli.StringFlag{
+			Name:   "dns-tsig-secret",
+			Usage:  "the base64 TSIG secret signing rfc2136 updates",
+			EnvVar: "JULY_DNS_TSIG_SECRET",
+		},
+		cli.StringFlag{
+			Name:   "dns-tsig-algorithm",
+			Value:  dns.DefaultTSIGAlgorithm,
+			Usage:  "the TSIG algorithm: hmac-md5, hmac-sha1, hmac-sha256 or hmac-sha512",
+			EnvVar: "JULY_DNS_TSIG_ALGORITHM",
+		},
+	}
+}
+
+func newDNSProvider(c *cli.Context) (dns.Provider, error) {
+	log.Debugf("dns provider: %s, dns endpoint: %s", c.String("dns-provider"), c.String("dns-endpoint"))
+	return dns.NewProvider(dns.ProviderConfig{
+		Name:     c.String("dns-provider"),
+		Endpoint: c.String("dns-endpoint"),
+		Auth: dns.AuthConfig{
+			Scheme:      c.String("dns-auth-scheme"),
+			User:        c.String("dns-user"),
+			Password:    c.String("dns-password"),
+			Token:       c.String("dns-token"),
+			SecretsFile: c.String("dns-secrets-file"),
+		},
+		EtcdPrefix: c.String("dns-etcd-prefix"),
+		RFC2136: dns.RFC2136Config{
+			Server:        c.String("dns-rfc2136-server"),
+			Zone:          c.String("dns-rfc2136-zone"),
+			TTL:           uint32(c.Int("dns-rfc2136-ttl")),
+			TSIGKeyName:   c.String("dns-tsig-key"),
+			TSIGSecret:    c.String("dns-tsig-secret"),
+			TSIGAlgorithm: c.String("dns-tsig-algorithm"),
+		},
+	})
+}
+
+func pendingDNSAction(c *cli.Context) {
+	output := c.String("output")
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	entries, err := dns.PendingOperations(c.String("host"))
+	if err != nil {
+		log.Fatal("list pending dns operations failed. Error: ", err)
+		return
+	}
+
+	if dataOutput(output) {
+		if entries == nil {
+			entries = []*dns.OutboxEntry{}
+		}
+
+		if err := printData(output, entries); err != nil {
+			log.Error("print pending dns operations failed. Error: ", err)
+		}
+		return
+	}
+
+	var rows [][]string
+	for _, entry := range entries {
+		nextAttempt := "now"
+		if entry.NextAttempt.After(time.Now()) {
+			nextAttempt = entry.NextAttempt.Format(time.RFC3339)
+		}
+
+		rows = append(rows, []string{shortID(entry.Host), entry.ID, strconv.Itoa(len(entry.Adds)), strconv.Itoa(len(entry.Deletes)),
+			strconv.Itoa(entry.Attempts), nextAttempt, entry.LastError})
+	}
+
+	printTable([]string{"HOST", "ID", "ADD", "DELETE", "ATTEMPTS", "NEXT ATTEMPT", "LAST ERROR"}, rows)
+}
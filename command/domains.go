@@ -0,0 +1,470 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+	dns "github.com/upccup/july/dns-handler"
+	event "github.com/upccup/july/docker-event"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	mdns "github.com/miekg/dns"
+)
+
+const (
+	VerifyOK       = "ok"
+	VerifyMissing  = "missing"
+	VerifyMismatch = "mismatch"
+)
+
+// domainBinding is a stored container domain with its container ID
+type domainBinding struct {
+	ID string
+	*event.ContainerIPInfo
+}
+
+// domainCheck is the verify result of one name of a container
+type domainCheck struct {
+	ID       string
+	Name     string
+	Stored   []string
+	Resolved []string
+	Status   string
+}
+
+func NewDomainsCommand() cli.Command {
+	filterFlags := []cli.Flag{
+		cli.StringFlag{Name: "zone", Usage: "only the domains in this zone"},
+		cli.StringFlag{Name: "host", Usage: "only the domains of containers on this host (docker daemon ID or prefix)"},
+		cli.StringFlag{Name: "ip", Usage: "only the domains bound to this ip"},
+	}
+
+	return cli.Command{
+		Name:  "domains",
+		Usage: "inspect the container domains bound by the listeners of all hosts",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "list the container domains",
+				Flags:  append(filterFlags, newOutputFlag()),
+				Action: listDomainsAction,
+			},
+			{
+				Name:  "show",
+				Usage: "show a container domain and its records",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "id", Usage: "the container ID or prefix"},
+					newOutputFlag(),
+				},
+				Action: showDomainAction,
+			},
+			{
+				Name:  "flush",
+				Usage: "remove container domains from the store, e.g. the ones of a lost host",
+				Flags: append(append(filterFlags,
+					cli.StringFlag{Name: "id", Usage: "the container ID or prefix"},
+					cli.BoolFlag{Name: "all", Usage: "flush every domain when no filter is set"},
+					cli.BoolFlag{Name: "records", Usage: "also delete the records from the dns backend"},
+				), dnsProviderFlags()...),
+				Action: flushDomainsAction,
+			},
+			{
+				Name:  "verify",
+				Usage: "check every published name resolves to the stored ip through the dns backend",
+				Flags: append(append(filterFlags,
+					cli.StringFlag{Name: "resolver", Usage: "resolve the names through this dns server (host:port) instead of listing the backend records"},
+					newOutputFlag(),
+				), dnsProviderFlags()...),
+				Action: verifyDomainsAction,
+			},
+		},
+	}
+}
+
+func listDomainsAction(c *cli.Context) {
+	output := c.String("output")
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	bindings, err := filterDomains(c)
+	if err != nil {
+		log.Fatal("list domains failed. Error: ", err)
+		return
+	}
+
+	printDomains(output, bindings)
+}
+
+func showDomainAction(c *cli.Context) {
+	id := c.String("id")
+	output := c.String("output")
+	if id == "" {
+		log.Error("invalid id argument: empty")
+		return
+	}
+
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	bindings, err := filterDomains(c)
+	if err != nil {
+		log.Fatal("get domains failed. Error: ", err)
+		return
+	}
+
+	if len(bindings) != 1 {
+		log.Fatalf("%d domains match id %s", len(bindings), id)
+		return
+	}
+
+	binding := bindings[0]
+	if dataOutput(output) {
+		if err := printData(output, binding); err != nil {
+			log.Error("print domain failed. Error: ", err)
+		}
+		return
+	}
+
+	printDomains(output, bindings)
+	if binding.Withdrawn {
+		return
+	}
+
+	var rows [][]string
+	for _, record := range binding.Records() {
+		rows = append(rows, []string{record.FQDN(), record.Type, recordValue(record)})
+	}
+
+	log.Infof("records of container %s:", shortID(binding.ID))
+	printTable([]string{"NAME", "TYPE", "VALUE"}, rows)
+}
+
+func flushDomainsAction(c *cli.Context) {
+	if !c.Bool("all") && c.String("id") == "" && c.String("zone") == "" && c.String("host") == "" && c.String("ip") == "" {
+		log.Error("nothing to flush: set --id, a filter or --all")
+		return
+	}
+
+	bindings, err := filterDomains(c)
+	if err != nil {
+		log.Fatal("get domains failed. Error: ", err)
+		return
+	}
+
+	var provider dns.Provider
+	if c.Bool("records") {
+		if provider, err = newDNSProvider(c); err != nil {
+			log.Fatalf("create dns provider got error: %+v", err)
+			return
+		}
+	}
+
+	for _, binding := range bindings {
+		if provider != nil && !binding.Withdrawn {
+			for _, record := range binding.Records() {
+				if err := provider.DeleteRecord(record); err != nil {
+					log.Errorf("delete dns record %s failed. Error: %s", record, err.Error())
+				}
+			}
+		}
+
+		if err := db.DeleteKey(filepath.Join(config.ContainerDomainsStorePath, binding.ID)); err != nil {
+			log.Errorf("flush domain of container %s failed. Error: %s", binding.ID, err.Error())
+			continue
+		}
+
+		log.Infof("flushed domain %s of container %s", binding.Domain+"."+binding.Zone, shortID(binding.ID))
+	}
+}
+
+func verifyDomainsAction(c *cli.Context) {
+	output := c.String("output")
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	bindings, err := filterDomains(c)
+	if err != nil {
+		log.Fatal("get domains failed. Error: ", err)
+		return
+	}
+
+	resolve := resolverLookup(c.String("resolver"))
+	if c.String("resolver") == "" {
+		provider, err := newDNSProvider(c)
+		if err != nil {
+			log.Fatalf("create dns provider got error: %+v", err)
+			return
+		}
+		resolve = backendLookup(provider)
+	}
+
+	var checks []domainCheck
+	failed := 0
+	for _, binding := range bindings {
+		if binding.Withdrawn {
+			continue
+		}
+
+		var stored []string
+		for _, address := range binding.Addresses() {
+			stored = append(stored, address.IP)
+		}
+
+		for _, name := range binding.AllNames() {
+			resolved, err := resolve(name)
+			if err != nil {
+				log.Fatalf("resolve %s failed. Error: %s", name.FQDN(), err.Error())
+				return
+			}
+
+			check := domainCheck{ID: binding.ID, Name: name.FQDN(), Stored: stored, Resolved: resolved, Status: verifyStatus(stored, resolved)}
+			if check.Status != VerifyOK {
+				failed++
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	if dataOutput(output) {
+		if checks == nil {
+			checks = []domainCheck{}
+		}
+
+		if err := printData(output, checks); err != nil {
+			log.Error("print verify result failed. Error: ", err)
+		}
+	} else {
+		var rows [][]string
+		for _, check := range checks {
+			rows = append(rows, []string{shortID(check.ID), check.Name, strings.Join(check.Stored, ","),
+				strings.Join(check.Resolved, ","), check.Status})
+		}
+		printTable([]string{"CONTAINER", "NAME", "STORED", "RESOLVED", "STATUS"}, rows)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d names don't resolve to the stored ip", failed, len(checks))
+	}
+}
+
+// verifyStatus is ok when every stored ip resolves, a name resolving to other
+// addresses only is a mismatch
+func verifyStatus(stored, resolved []string) string {
+	if len(resolved) == 0 {
+		return VerifyMissing
+	}
+
+	for _, ip := range stored {
+		if !containsString(resolved, ip) {
+			return VerifyMismatch
+		}
+	}
+
+	return VerifyOK
+}
+
+type lookupFunc func(name event.DomainName) ([]string, error)
+
+// backendLookup finds the address records of a name in the records the
+// backend lists for its zone
+func backendLookup(provider dns.Provider) lookupFunc {
+	zones := make(map[string][]dns.Record)
+	return func(name event.DomainName) ([]string, error) {
+		records, ok := zones[name.Zone]
+		if !ok {
+			var err error
+			if records, err = provider.ListRecords(name.Zone); err != nil {
+				if err == dns.ErrListNotSupported {
+					return nil, fmt.Errorf("the dns backend can't list records, verify with --resolver")
+				}
+				return nil, err
+			}
+			zones[name.Zone] = records
+		}
+
+		var addresses []string
+		for _, record := range records {
+			if record.Type != dns.RecordTypeA && record.Type != dns.RecordTypeAAAA {
+				continue
+			}
+
+			if strings.EqualFold(strings.TrimSuffix(record.FQDN(), "."), strings.TrimSuffix(name.FQDN(), ".")) {
+				addresses = append(addresses, record.Value)
+			}
+		}
+
+		return addresses, nil
+	}
+}
+
+// resolverLookup queries the A and AAAA records of a name to a dns server
+func resolverLookup(server string) lookupFunc {
+	client := &mdns.Client{Timeout: 5 * time.Second}
+	return func(name event.DomainName) ([]string, error) {
+		var addresses []string
+		for _, qtype := range []uint16{mdns.TypeA, mdns.TypeAAAA} {
+			msg := new(mdns.Msg)
+			msg.SetQuestion(mdns.Fqdn(name.FQDN()), qtype)
+			resp, _, err := client.Exchange(msg, server)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, rr := range resp.Answer {
+				switch v := rr.(type) {
+				case *mdns.A:
+					addresses = append(addresses, v.A.String())
+				case *mdns.AAAA:
+					addresses = append(addresses, v.AAAA.String())
+				}
+			}
+		}
+
+		return addresses, nil
+	}
+}
+
+// filterDomains returns the stored domains matching the id, zone, host and
+// ip flags, sorted by domain
+func filterDomains(c *cli.Context) ([]domainBinding, error) {
+	infos, err := event.StoredContainerIPInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	id, zone, host, ip := c.String("id"), c.String("zone"), c.String("host"), c.String("ip")
+	var bindings []domainBinding
+	for ID, info := range infos {
+		if id != "" && !strings.HasPrefix(ID, id) {
+			continue
+		}
+
+		if host != "" && !strings.HasPrefix(info.Host, host) {
+			continue
+		}
+
+		if zone != "" && !inZone(info, zone) {
+			continue
+		}
+
+		if ip != "" && !hasAddress(info, ip) {
+			continue
+		}
+
+		bindings = append(bindings, domainBinding{ID: ID, ContainerIPInfo: info})
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].Domain+"."+bindings[i].Zone < bindings[j].Domain+"."+bindings[j].Zone
+	})
+
+	return bindings, nil
+}
+
+func inZone(info *event.ContainerIPInfo, zone string) bool {
+	zone = strings.TrimSuffix(zone, ".")
+	for _, name := range info.AllNames() {
+		if strings.EqualFold(strings.TrimSuffix(name.Zone, "."), zone) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasAddress(info *event.ContainerIPInfo, ip string) bool {
+	for _, address := range info.Addresses() {
+		if net.ParseIP(address.IP).Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func printDomains(output string, bindings []domainBinding) {
+	if dataOutput(output) {
+		if bindings == nil {
+			bindings = []domainBinding{}
+		}
+
+		if err := printData(output, bindings); err != nil {
+			log.Error("print domains failed. Error: ", err)
+		}
+		return
+	}
+
+	var rows [][]string
+	for _, binding := range bindings {
+		var ips []string
+		for _, address := range binding.Addresses() {
+			ips = append(ips, address.IP)
+		}
+
+		status := "published"
+		if binding.Withdrawn {
+			status = "withdrawn"
+		}
+
+		if output == OutputWide {
+			var aliases []string
+			for _, alias := range binding.Aliases {
+				aliases = append(aliases, alias.FQDN())
+			}
+
+			rows = append(rows, []string{binding.ID, binding.Name, binding.Domain + "." + binding.Zone, strings.Join(aliases, ","),
+				strings.Join(ips, ","), strconv.FormatUint(uint64(binding.TTL), 10), binding.Host, status})
+			continue
+		}
+
+		rows = append(rows, []string{shortID(binding.ID), binding.Name, binding.Domain + "." + binding.Zone,
+			strings.Join(ips, ","), shortID(binding.Host), status})
+	}
+
+	if output == OutputWide {
+		printTable([]string{"CONTAINER", "NAME", "DOMAIN", "ALIASES", "IP", "TTL", "HOST", "STATUS"}, rows)
+		return
+	}
+
+	printTable([]string{"CONTAINER", "NAME", "DOMAIN", "IP", "HOST", "STATUS"}, rows)
+}
+
+func recordValue(record dns.Record) string {
+	if record.Type == dns.RecordTypeSRV {
+		return fmt.Sprintf("%d %d %d %s", record.Priority, record.Weight, record.Port, record.Value)
+	}
+
+	return record.Value
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package command
+
+import (
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+const EnvPrefix = "JULY_"
+
+// WithEnvVars lets every flag of the commands be set by an environment
+// variable: JULY_<COMMAND>_<FLAG>, e.g. JULY_CREATE_NETWORK_MODE. Flags
+// declaring their own variable, like the server settings, keep it
+func WithEnvVars(commands ...cli.Command) []cli.Command {
+	return withEnvVars(EnvPrefix, commands)
+}
+
+// Commands are the commands of july, with the environment variables of
+// their flags
+func Commands() []cli.Command {
+	return WithEnvVars(
+		NewServerCommand(),
+		NewIPRangeCommand(),
+		NewAddHostCommand(),
+		NewReleaseIPCommand(),
+		NewReleaseHostCommand(),
+		NewCreateNetworkCommand(),
+		NewShowAssignedIPCommand(),
+		NewShowIPPoolCommand(),
+		NewAddContainerIPCommand(),
+		NewHostCommand(),
+		NewDNSCommand(),
+		NewDomainsCommand(),
+		NewConfigCommand(),
+	)
+}
+
+func withEnvVars(prefix string, commands []cli.Command) []cli.Command {
+	for i, command := range commands {
+		commandPrefix := prefix + envName(command.Name) + "_"
+		flags := make([]cli.Flag, len(command.Flags))
+		for j, flag := range command.Flags {
+			flags[j] = withEnvVar(flag, commandPrefix+envName(flagName(flag)))
+		}
+
+		commands[i].Flags = flags
+		commands[i].Subcommands = withEnvVars(commandPrefix, command.Subcommands)
+	}
+
+	return commands
+}
+
+// withEnvVar sets the environment variable of a flag which has none
+func withEnvVar(flag cli.Flag, envVar string) cli.Flag {
+	if flagEnvVar(flag) != "" {
+		return flag
+	}
+
+	switch f := flag.(type) {
+	case cli.StringFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.BoolFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.BoolTFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.IntFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.DurationFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.Float64Flag:
+		f.EnvVar = envVar
+		return f
+	case cli.StringSliceFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.IntSliceFlag:
+		f.EnvVar = envVar
+		return f
+	case cli.GenericFlag:
+		f.EnvVar = envVar
+		return f
+	}
+
+	return flag
+}
+
+func flagEnvVar(flag cli.Flag) string {
+	switch f := flag.(type) {
+	case cli.StringFlag:
+		return f.EnvVar
+	case cli.BoolFlag:
+		return f.EnvVar
+	case cli.BoolTFlag:
+		return f.EnvVar
+	case cli.IntFlag:
+		return f.EnvVar
+	case cli.DurationFlag:
+		return f.EnvVar
+	case cli.Float64Flag:
+		return f.EnvVar
+	case cli.StringSliceFlag:
+		return f.EnvVar
+	case cli.IntSliceFlag:
+		return f.EnvVar
+	case cli.GenericFlag:
+		return f.EnvVar
+	}
+
+	return ""
+}
+
+// flagName is the long name of a flag, e.g. output for "output, o"
+func flagName(flag cli.Flag) string {
+	return strings.TrimSpace(strings.Split(flag.GetName(), ",")[0])
+}
+
+// lookupEnv returns the first non empty of the comma separated environment
+// variables of a flag, the way cli reads them
+func lookupEnv(envVars string) (string, bool) {
+	for _, envVar := range strings.Split(envVars, ",") {
+		if value := os.Getenv(strings.TrimSpace(envVar)); value != "" {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+func envName(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
@@ -0,0 +1,180 @@
+package command
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/upccup/july/bridge"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+func NewHostCommand() cli.Command {
+	return cli.Command{
+		Name:  "host",
+		Usage: "manage the host network configs",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "list all configured hosts with their assignment status",
+				Flags:  []cli.Flag{newOutputFlag()},
+				Action: listHostAction,
+			},
+			{
+				Name:  "show",
+				Usage: "show the network config of a host",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "ip", Usage: "the host ip"},
+					newOutputFlag(),
+				},
+				Action: showHostAction,
+			},
+			{
+				Name:  "update",
+				Usage: "update the subnet and/or gateway of a host",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "ip", Usage: "the host ip"},
+					cli.StringFlag{Name: "subnet", Usage: "the new subnet where the host is located"},
+					cli.StringFlag{Name: "gateway", Usage: "the new host gateway"},
+					newOutputFlag(),
+				},
+				Action: updateHostAction,
+			},
+			{
+				Name:  "remove",
+				Usage: "remove the config and the assigned marker of a host",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "ip", Usage: "the host ip"},
+					cli.BoolFlag{Name: "force", Usage: "remove the host even if it has created its network"},
+				},
+				Action: removeHostAction,
+			},
+		},
+	}
+}
+
+func listHostAction(c *cli.Context) {
+	output := c.String("output")
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	hosts, err := bridge.ListHosts()
+	if err != nil {
+		log.Fatal("list hosts failed. Error: ", err)
+		return
+	}
+
+	printHosts(output, hosts)
+}
+
+func showHostAction(c *cli.Context) {
+	ip := c.String("ip")
+	output := c.String("output")
+	if ip == "" || net.ParseIP(ip) == nil {
+		log.Errorf("invalid ip argument: %s", ip)
+		return
+	}
+
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	host, err := bridge.GetHost(ip)
+	if err != nil {
+		log.Fatalf("get host %s failed. Error: %s", ip, err.Error())
+		return
+	}
+
+	printHosts(output, []*bridge.HostInfo{host})
+}
+
+func updateHostAction(c *cli.Context) {
+	ip := c.String("ip")
+	subnet := c.String("subnet")
+	gateway := c.String("gateway")
+	output := c.String("output")
+
+	if ip == "" || net.ParseIP(ip) == nil {
+		log.Errorf("invalid ip argument: %s", ip)
+		return
+	}
+
+	if subnet == "" && gateway == "" {
+		log.Error("nothing to update: set --subnet and/or --gateway")
+		return
+	}
+
+	if subnet != "" {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			log.Error("invalid subnet argument: ", err)
+			return
+		}
+	}
+
+	if gateway != "" && net.ParseIP(gateway) == nil {
+		log.Errorf("invalid gateway argument: %s", gateway)
+		return
+	}
+
+	if !validOutput(output) {
+		log.Errorf("invalid output argument: %s", output)
+		return
+	}
+
+	host, err := bridge.UpdateHost(ip, subnet, gateway)
+	if err != nil {
+		log.Fatalf("update host %s failed. Error: %s", ip, err.Error())
+		return
+	}
+
+	printHosts(output, []*bridge.HostInfo{host})
+}
+
+func removeHostAction(c *cli.Context) {
+	ip := c.String("ip")
+	if ip == "" || net.ParseIP(ip) == nil {
+		log.Errorf("invalid ip argument: %s", ip)
+		return
+	}
+
+	host, err := bridge.GetHost(ip)
+	if err != nil {
+		log.Fatalf("get host %s failed. Error: %s", ip, err.Error())
+		return
+	}
+
+	if host.Assigned && !c.Bool("force") {
+		log.Errorf("host %s has created network %s, use --force to remove it anyway", ip, host.Network)
+		return
+	}
+
+	if err := bridge.RemoveHost(ip); err != nil {
+		log.Fatalf("remove host %s failed. Error: %s", ip, err.Error())
+		return
+	}
+}
+
+func printHosts(output string, hosts []*bridge.HostInfo) {
+	if dataOutput(output) {
+		if hosts == nil {
+			hosts = []*bridge.HostInfo{}
+		}
+
+		if err := printData(output, hosts); err != nil {
+			log.Error("print hosts failed. Error: ", err)
+		}
+		return
+	}
+
+	var rows [][]string
+	for _, host := range hosts {
+		rows = append(rows, []string{host.IP, host.Subnet, host.Gateway,
+			strconv.FormatBool(host.Assigned), host.Mode, host.Network})
+	}
+
+	printTable([]string{"IP", "SUBNET", "GATEWAY", "ASSIGNED", "MODE", "NETWORK"}, rows)
+}
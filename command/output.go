@@ -0,0 +1,88 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OutputTable = "table"
+	OutputWide  = "wide"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+func newOutputFlag() cli.StringFlag {
+	return cli.StringFlag{Name: "output, o", Value: OutputTable, Usage: "the output format: table, wide, json or yaml", EnvVar: "JULY_OUTPUT"}
+}
+
+func validOutput(output string) bool {
+	switch output {
+	case OutputTable, OutputWide, OutputJSON, OutputYAML:
+		return true
+	}
+
+	return false
+}
+
+// dataOutput tells the output is json or yaml rather than a table
+func dataOutput(output string) bool {
+	return output == OutputJSON || output == OutputYAML
+}
+
+// printData writes v to stdout as json or yaml, the yaml keys are the json
+// ones
+func printData(output string, v interface{}) error {
+	if output == OutputJSON {
+		return printJSON(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	return printYAML(doc)
+}
+
+// printTable writes the header and rows aligned in columns to stdout
+func printTable(header []string, rows [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	writeRow(w, header)
+	for _, row := range rows {
+		writeRow(w, row)
+	}
+	w.Flush()
+}
+
+func writeRow(w io.Writer, row []string) {
+	fmt.Fprintln(w, strings.Join(row, "\t"))
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printYAML(v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -7,11 +7,25 @@ import (
 const (
 	ContainerIPStorePrefix    = "/jdjr/containers"
 	ContainerDomainsStorePath = "/jdjr/container-domains"
+	ServiceDomainsStorePath   = "/jdjr/service-domains"
 	HostAssignedIPStorePath   = "/jdjr/hosts/assigned"
+	HostIPConfigStorePath     = "/jdjr/hosts/config"
+	NetworkDriverStorePrefix  = "/jdjr/network-driver"
+	RecordOwnersStorePath     = "/jdjr/record-owners"
+	DNSOutboxStorePath        = "/jdjr/dns-outbox"
+	EventCheckpointStorePath  = "/jdjr/event-checkpoints"
 )
 
 func GetHostIPConfigStorePath(ip string) string {
-	return filepath.Join("/jdjr/hosts/config", ip)
+	return filepath.Join(HostIPConfigStorePath, ip)
+}
+
+func GetDNSOutboxStorePath(hostID string) string {
+	return filepath.Join(DNSOutboxStorePath, hostID)
+}
+
+func GetEventCheckpointStorePath(hostID string) string {
+	return filepath.Join(EventCheckpointStorePath, hostID)
 }
 
 func ContainerIPPoolSotrePath(ipNet string) string {
@@ -25,3 +39,11 @@ func ContainerAssignedIPSotrePath(ipNet string) string {
 func ContainerIPConfigSotrePath(ipNet string) string {
 	return filepath.Join(ContainerIPStorePrefix, ipNet, "config")
 }
+
+func NetworkDriverNetworkStorePath(networkID string) string {
+	return filepath.Join(NetworkDriverStorePrefix, "networks", networkID)
+}
+
+func NetworkDriverEndpointStorePath(endpointID string) string {
+	return filepath.Join(NetworkDriverStorePrefix, "endpoints", endpointID)
+}
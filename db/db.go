@@ -19,7 +19,10 @@ func GetKey(key string) (string, error) {
 	cli := newClient()
 	kapi := client.NewKeysAPI(cli)
 	resp, err := kapi.Get(context.Background(), key, nil)
-	if err != nil {
+	if client.IsKeyNotFound(err) {
+		log.Debug(err)
+		return "", err
+	} else if err != nil {
 		log.Error(err)
 		return "", err
 	} else {
@@ -41,6 +44,65 @@ func GetKeys(dir string) (client.Nodes, error) {
 	return resp.Node.Nodes, err
 }
 
+// GetKeysWithIndex returns the nodes under dir together with the store index
+// they were read at, so that a watch can continue right after them
+func GetKeysWithIndex(dir string) (client.Nodes, uint64, error) {
+	cli := newClient()
+	kapi := client.NewKeysAPI(cli)
+	resp, err := kapi.Get(context.Background(), dir, &client.GetOptions{Sort: true})
+	if err != nil {
+		log.Error(err)
+		return nil, 0, err
+	}
+
+	log.Debugf("Get %d keys from dir %s at index %d", len(resp.Node.Nodes), resp.Node.Key, resp.Index)
+	return resp.Node.Nodes, resp.Index, nil
+}
+
+// WatchKeys calls handler with every change under dir after afterIndex. It
+// only returns when the watch fails, e.g. the index has been compacted.
+func WatchKeys(dir string, afterIndex uint64, handler func(resp *client.Response)) error {
+	cli := newClient()
+	kapi := client.NewKeysAPI(cli)
+	watcher := kapi.Watcher(dir, &client.WatcherOptions{AfterIndex: afterIndex, Recursive: true})
+	for {
+		resp, err := watcher.Next(context.Background())
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("Watch got %s of key %s", resp.Action, resp.Node.Key)
+		handler(resp)
+	}
+}
+
+// GetKeysRecursive returns all the leaf nodes under dir
+func GetKeysRecursive(dir string) (client.Nodes, error) {
+	cli := newClient()
+	kapi := client.NewKeysAPI(cli)
+	resp, err := kapi.Get(context.Background(), dir, &client.GetOptions{Sort: true, Recursive: true})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	leaves := leafNodes(resp.Node.Nodes)
+	log.Debugf("Get %d leaf keys from dir %s", len(leaves), resp.Node.Key)
+	return leaves, nil
+}
+
+func leafNodes(nodes client.Nodes) client.Nodes {
+	var leaves client.Nodes
+	for _, node := range nodes {
+		if node.Dir {
+			leaves = append(leaves, leafNodes(node.Nodes)...)
+			continue
+		}
+		leaves = append(leaves, node)
+	}
+	return leaves
+}
+
 func IsKeyExist(key string) bool {
 	cli := newClient()
 	kapi := client.NewKeysAPI(cli)
@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	AuthSchemeMD5        = "md5"
+	AuthSchemeHMACSHA256 = "hmac-sha256"
+	AuthSchemeBearer     = "bearer"
+)
+
+// Authenticator signs the requests sent to the dns console.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthConfig holds the console credentials. Values read from SecretsFile
+// only fill the fields which are still empty, so flags and env win.
+type AuthConfig struct {
+	Scheme      string
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	Token       string `json:"token"`
+	SecretsFile string
+}
+
+func NewAuthenticator(cfg AuthConfig) (Authenticator, error) {
+	if cfg.SecretsFile != "" {
+		if err := cfg.loadSecretsFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch cfg.Scheme {
+	case AuthSchemeMD5, "":
+		if cfg.User == "" || cfg.Password == "" {
+			return nil, fmt.Errorf("%s auth requires the console user and password", AuthSchemeMD5)
+		}
+		return &MD5Authenticator{User: cfg.User, Password: cfg.Password}, nil
+	case AuthSchemeHMACSHA256:
+		if cfg.User == "" || cfg.Password == "" {
+			return nil, fmt.Errorf("%s auth requires the console user and password", AuthSchemeHMACSHA256)
+		}
+		return &HMACSHA256Authenticator{User: cfg.User, Secret: cfg.Password}, nil
+	case AuthSchemeBearer:
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("%s auth requires the console token", AuthSchemeBearer)
+		}
+		return &BearerTokenAuthenticator{Token: cfg.Token}, nil
+	}
+
+	return nil, fmt.Errorf("unknown dns console auth scheme %s", cfg.Scheme)
+}
+
+// loadSecretsFile reads a json file like {"user": "", "password": "", "token": ""}
+func (cfg *AuthConfig) loadSecretsFile() error {
+	content, err := ioutil.ReadFile(cfg.SecretsFile)
+	if err != nil {
+		return err
+	}
+
+	var secrets AuthConfig
+	if err := json.Unmarshal(content, &secrets); err != nil {
+		return fmt.Errorf("parse secrets file %s failed: %s", cfg.SecretsFile, err.Error())
+	}
+
+	if cfg.User == "" {
+		cfg.User = secrets.User
+	}
+
+	if cfg.Password == "" {
+		cfg.Password = secrets.Password
+	}
+
+	if cfg.Token == "" {
+		cfg.Token = secrets.Token
+	}
+
+	return nil
+}
+
+// MD5Authenticator is the original console scheme: the token is the md5 of
+// timestamp + random + password
+type MD5Authenticator struct {
+	User     string
+	Password string
+}
+
+func (a *MD5Authenticator) Authenticate(req *http.Request) error {
+	timeStamp := strconv.FormatInt(time.Now().Unix(), 10)
+	token := fmt.Sprintf("%x", md5.Sum([]byte(timeStamp+timeStamp+a.Password)))
+	setConsoleAuthHeader(req, a.User, timeStamp, token)
+	return nil
+}
+
+// HMACSHA256Authenticator sends the same headers as MD5Authenticator but the
+// token is the hmac-sha256 of timestamp + random keyed by the secret
+type HMACSHA256Authenticator struct {
+	User   string
+	Secret string
+}
+
+func (a *HMACSHA256Authenticator) Authenticate(req *http.Request) error {
+	timeStamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(a.Secret))
+	mac.Write([]byte(timeStamp + timeStamp))
+	setConsoleAuthHeader(req, a.User, timeStamp, fmt.Sprintf("%x", mac.Sum(nil)))
+	return nil
+}
+
+type BearerTokenAuthenticator struct {
+	Token string
+}
+
+func (a *BearerTokenAuthenticator) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+func setConsoleAuthHeader(req *http.Request, user, timeStamp, token string) {
+	req.Header.Set("Auth-User", user)
+	req.Header.Set("Auth-Random", timeStamp)
+	req.Header.Set("Auth-TimeStamp", timeStamp)
+	req.Header.Set("Auth-Token", token)
+}
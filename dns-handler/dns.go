@@ -2,24 +2,20 @@ package dns
 
 import (
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
 
 	log "github.com/Sirupsen/logrus"
 )
 
 type DNSClient struct {
-	Endpoint string
+	Endpoint      string
+	Authenticator Authenticator
 }
 
 const (
-	DNSPassword        = "abcc"
 	AddDNSRecordURL    = "%s/api/domain_add"
 	DeleteDNSRecordURL = "%s/api/domain_delete"
 )
@@ -36,17 +32,51 @@ type AddressRecord struct {
 	Area    int    `json:"area"`
 }
 
-func (dClient *DNSClient) AddDNSRecord(domainZone, domainName, address string) error {
-	addressRecord := AddressRecord{
-		Address: address,
-		Type:    "A",
-		Area:    1,
+// AddRecord adds the address of record to its domain. Owned records are
+// registered first and the domain is published with the addresses of all its
+// owners, so that the other owners survive when this one is deleted.
+func (dClient *DNSClient) AddRecord(record Record) error {
+	if record.Owner == "" {
+		return dClient.addDNSRecords(record.Zone, record.FQDN(), []Record{record})
+	}
+
+	if err := setOwner(record); err != nil {
+		return err
+	}
+
+	records, err := ownedRecords(record)
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		records = []Record{record}
+	}
+
+	return dClient.addDNSRecords(record.Zone, record.FQDN(), records)
+}
+
+func (dClient *DNSClient) addDNSRecords(domainZone, fullDomain string, records []Record) error {
+	var addressRecords []AddressRecord
+	for _, record := range records {
+		addressRecord := AddressRecord{
+			Address: record.Value,
+			Type:    record.Type,
+			Area:    1,
+		}
+
+		// the console takes the whole rdata of a SRV record as its address
+		if record.Type == RecordTypeSRV {
+			addressRecord.Address = fmt.Sprintf("%d %d %d %s", record.Priority, record.Weight, record.Port, record.Value)
+		}
+
+		addressRecords = append(addressRecords, addressRecord)
 	}
 
 	dnsRecord := DNSRecord{
-		FullDomain:     domainName + "." + domainZone,
+		FullDomain:     fullDomain,
 		Main:           domainZone,
-		AddressRecords: []AddressRecord{addressRecord},
+		AddressRecords: addressRecords,
 	}
 
 	body, err := encodeData([]DNSRecord{dnsRecord})
@@ -60,7 +90,9 @@ func (dClient *DNSClient) AddDNSRecord(domainZone, domainName, address string) e
 		return err
 	}
 
-	addAuthToRequestHeader(req)
+	if err := dClient.Authenticator.Authenticate(req); err != nil {
+		return err
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -89,10 +121,49 @@ func (dClient *DNSClient) AddDNSRecord(domainZone, domainName, address string) e
 	return nil
 }
 
-func (dClient *DNSClient) DeleteDNSRecord(domain string) error {
+// DeleteRecord removes the domain of record. The console can only delete a
+// whole domain, so when other owners remain the domain is published again
+// with their addresses.
+func (dClient *DNSClient) DeleteRecord(record Record) error {
+	if record.Owner == "" {
+		return dClient.DeleteDNSRecord(record.Zone, record.Name)
+	}
+
+	remaining, err := releaseOwner(record)
+	if err != nil {
+		return err
+	}
+
+	if err := dClient.DeleteDNSRecord(record.Zone, record.Name); err != nil {
+		return err
+	}
+
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	log.Infof("domain %s still has %d owners, publish them again", record.FQDN(), len(remaining))
+	return dClient.addDNSRecords(record.Zone, record.FQDN(), remaining)
+}
+
+// ListRecords is not supported, the console api has no way to query a zone
+func (dClient *DNSClient) ListRecords(zone string) ([]Record, error) {
+	return nil, ErrListNotSupported
+}
+
+func (dClient *DNSClient) AddDNSRecord(domainZone, domainName, address string) error {
+	return dClient.AddRecord(Record{
+		Name:  domainName,
+		Zone:  domainZone,
+		Type:  AddressRecordType(address),
+		Value: address,
+	})
+}
+
+func (dClient *DNSClient) DeleteDNSRecord(domainZone, domainName string) error {
 	dnsRecord := DNSRecord{
-		FullDomain: domain + ".cbpmgt.com.",
-		Main:       "cbpmgt.com.",
+		FullDomain: domainName + "." + domainZone,
+		Main:       domainZone,
 	}
 
 	body, err := encodeData([]DNSRecord{dnsRecord})
@@ -106,7 +177,9 @@ func (dClient *DNSClient) DeleteDNSRecord(domain string) error {
 		return err
 	}
 
-	addAuthToRequestHeader(req)
+	if err := dClient.Authenticator.Authenticate(req); err != nil {
+		return err
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -135,17 +208,6 @@ func (dClient *DNSClient) DeleteDNSRecord(domain string) error {
 	return nil
 }
 
-func addAuthToRequestHeader(req *http.Request) {
-	timeStamp := strconv.FormatInt(time.Now().Unix(), 10)
-	tokenStrList := []string{timeStamp, timeStamp, DNSPassword}
-	tokenStr := strings.Join(tokenStrList, "")
-	token := fmt.Sprintf("%x", md5.Sum([]byte(tokenStr)))
-	req.Header.Set("Auth-User", "yanhong3")
-	req.Header.Set("Auth-Random", timeStamp)
-	req.Header.Set("Auth-TimeStamp", timeStamp)
-	req.Header.Set("Auth-Token", token)
-}
-
 func encodeData(data interface{}) (*bytes.Buffer, error) {
 	params := bytes.NewBuffer(nil)
 	if data != nil {
@@ -0,0 +1,313 @@
+package dns
+
+import (
+	"encoding/json"
+	"expvar"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+)
+
+const (
+	DefaultRetryMin = time.Second
+	DefaultRetryMax = 5 * time.Minute
+)
+
+var (
+	outboxPending = expvar.NewInt("dns_outbox_pending")
+	outboxApplied = expvar.NewInt("dns_outbox_applied")
+	outboxFailed  = expvar.NewInt("dns_outbox_failed")
+)
+
+// OutboxEntry holds the record operations of one container which are not
+// applied to the backend yet
+type OutboxEntry struct {
+	// ID is the owner of the records, or the name of ownerless records
+	ID string
+	// Host is the docker daemon ID of the host which queued the operations,
+	// only that host applies them
+	Host        string
+	Adds        []Record `json:",omitempty"`
+	Deletes     []Record `json:",omitempty"`
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string `json:",omitempty"`
+	Created     time.Time
+}
+
+// Outbox is a Provider which persists every operation in the store before
+// applying it to Provider, failed operations are retried with exponential
+// backoff until they succeed. The entries are kept per host, so every host
+// applies only its own operations.
+type Outbox struct {
+	Provider Provider
+	HostID   string
+	RetryMin time.Duration
+	RetryMax time.Duration
+
+	lock sync.Mutex
+	wake chan struct{}
+}
+
+func NewOutbox(provider Provider, hostID string) *Outbox {
+	return &Outbox{
+		Provider: provider,
+		HostID:   hostID,
+		RetryMin: DefaultRetryMin,
+		RetryMax: DefaultRetryMax,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (o *Outbox) AddRecord(record Record) error {
+	return o.enqueue(record, true)
+}
+
+func (o *Outbox) DeleteRecord(record Record) error {
+	return o.enqueue(record, false)
+}
+
+func (o *Outbox) ListRecords(zone string) ([]Record, error) {
+	return o.Provider.ListRecords(zone)
+}
+
+// enqueue merges the operation into the entry of the record owner. A later
+// operation on the same record replaces the pending one, deletes are kept
+// even when the add never made it since the backend may have half applied it.
+func (o *Outbox) enqueue(record Record, add bool) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	id := outboxID(record)
+	entry, err := getOutboxEntry(o.HostID, id)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		entry = &OutboxEntry{ID: id, Host: o.HostID, Created: time.Now()}
+	}
+
+	if add {
+		entry.Deletes = withoutRecord(entry.Deletes, record)
+		entry.Adds = append(withoutRecord(entry.Adds, record), record)
+	} else {
+		entry.Adds = withoutRecord(entry.Adds, record)
+		entry.Deletes = append(withoutRecord(entry.Deletes, record), record)
+	}
+
+	// a new operation is tried right away
+	entry.NextAttempt = time.Time{}
+	if err := setOutboxEntry(entry); err != nil {
+		return err
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run applies the pending operations, it never returns
+func (o *Outbox) Run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		o.flush()
+
+		select {
+		case <-o.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Outbox) flush() {
+	entries, err := PendingOperations(o.HostID)
+	if err != nil {
+		log.Errorf("get pending dns operations failed. Error: %s", err.Error())
+		return
+	}
+
+	outboxPending.Set(int64(len(entries)))
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.NextAttempt.After(now) {
+			continue
+		}
+		o.process(entry)
+	}
+}
+
+// process applies the deletes then the adds of entry. The backend is called
+// without the lock, so the entry is read again before recording the result:
+// an operation queued meanwhile on the same record stays pending.
+func (o *Outbox) process(entry *OutboxEntry) {
+	var deleted, added []Record
+	var lastErr error
+	for _, record := range entry.Deletes {
+		if err := o.Provider.DeleteRecord(record); err != nil {
+			log.Errorf("delete dns record %s failed. Error: %s", record, err.Error())
+			lastErr = err
+			continue
+		}
+		deleted = append(deleted, record)
+	}
+
+	for _, record := range entry.Adds {
+		if err := o.Provider.AddRecord(record); err != nil {
+			log.Errorf("add dns record %s failed. Error: %s", record, err.Error())
+			lastErr = err
+			continue
+		}
+		added = append(added, record)
+	}
+
+	outboxApplied.Add(int64(len(deleted) + len(added)))
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	current, err := getOutboxEntry(o.HostID, entry.ID)
+	if err != nil || current == nil {
+		return
+	}
+
+	for _, record := range deleted {
+		current.Deletes = withoutRecord(current.Deletes, record)
+	}
+
+	for _, record := range added {
+		current.Adds = withoutRecord(current.Adds, record)
+	}
+
+	if len(current.Adds) == 0 && len(current.Deletes) == 0 {
+		if err := db.DeleteKey(outboxKey(o.HostID, entry.ID)); err != nil && !client.IsKeyNotFound(err) {
+			log.Errorf("delete dns outbox entry %s failed. Error: %s", entry.ID, err.Error())
+		}
+		return
+	}
+
+	if lastErr == nil {
+		// only new operations are left, they are tried on the next flush
+		setOutboxEntry(current)
+		return
+	}
+
+	outboxFailed.Add(1)
+	current.Attempts++
+	current.LastError = lastErr.Error()
+	current.NextAttempt = time.Now().Add(o.backoff(current.Attempts))
+	log.Warnf("dns operations of %s failed %d times, retry at %s", entry.ID, current.Attempts, current.NextAttempt.Format(time.RFC3339))
+	setOutboxEntry(current)
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.RetryMin
+	for i := 1; i < attempts && delay < o.RetryMax; i++ {
+		delay *= 2
+	}
+
+	if delay > o.RetryMax {
+		delay = o.RetryMax
+	}
+
+	return delay
+}
+
+// PendingOperations returns the operations waiting in the outbox of a host,
+// of every host when hostID is empty
+func PendingOperations(hostID string) ([]*OutboxEntry, error) {
+	var nodes client.Nodes
+	var err error
+	if hostID == "" {
+		nodes, err = db.GetKeysRecursive(config.DNSOutboxStorePath)
+	} else {
+		nodes, err = db.GetKeys(config.GetDNSOutboxStorePath(hostID))
+	}
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []*OutboxEntry
+	for _, node := range nodes {
+		var entry OutboxEntry
+		if err := json.Unmarshal([]byte(node.Value), &entry); err != nil {
+			log.Warnf("skip invalid dns outbox entry %s: %s", node.Key, err.Error())
+			continue
+		}
+
+		if entry.Host == "" {
+			entry.Host = path.Base(path.Dir(node.Key))
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+func outboxID(record Record) string {
+	if record.Owner != "" {
+		return record.Owner
+	}
+
+	return trimDot(record.FQDN())
+}
+
+func outboxKey(hostID, id string) string {
+	return path.Join(config.GetDNSOutboxStorePath(hostID), id)
+}
+
+func getOutboxEntry(hostID, id string) (*OutboxEntry, error) {
+	value, err := db.GetKey(outboxKey(hostID, id))
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entry OutboxEntry
+	if err := json.Unmarshal([]byte(value), &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func setOutboxEntry(entry *OutboxEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := db.SetKey(outboxKey(entry.Host, entry.ID), string(value)); err != nil {
+		log.Errorf("store dns outbox entry %s failed. Error: %s", entry.ID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func withoutRecord(records []Record, record Record) []Record {
+	var left []Record
+	for _, r := range records {
+		if r != record {
+			left = append(left, r)
+		}
+	}
+
+	return left
+}
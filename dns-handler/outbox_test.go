@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingProvider records the applied operations, the first call blocks
+// until release is closed
+type blockingProvider struct {
+	sync.Mutex
+	adds    []Record
+	deletes []Record
+	calls   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (p *blockingProvider) wait() {
+	p.Lock()
+	p.calls++
+	first := p.calls == 1
+	p.Unlock()
+
+	if first {
+		close(p.started)
+		<-p.release
+	}
+}
+
+func (p *blockingProvider) AddRecord(record Record) error {
+	p.wait()
+	p.Lock()
+	defer p.Unlock()
+
+	p.adds = append(p.adds, record)
+	return nil
+}
+
+func (p *blockingProvider) DeleteRecord(record Record) error {
+	p.wait()
+	p.Lock()
+	defer p.Unlock()
+
+	p.deletes = append(p.deletes, record)
+	return nil
+}
+
+func (p *blockingProvider) ListRecords(zone string) ([]Record, error) {
+	return nil, ErrListNotSupported
+}
+
+// an operation queued while the opposite one is sent to the backend must be
+// applied after it, not dropped with it
+func TestOutboxKeepsOperationQueuedWhileApplying(t *testing.T) {
+	record := Record{Name: "web", Zone: "example.com", Type: RecordTypeA, Value: "192.168.1.10", Owner: "c1"}
+
+	for _, add := range []bool{false, true} {
+		startStore(t)
+		provider := newBlockingProvider()
+		outbox := NewOutbox(provider, "host1")
+
+		queue := func(add bool) {
+			var err error
+			if add {
+				err = outbox.AddRecord(record)
+			} else {
+				err = outbox.DeleteRecord(record)
+			}
+			if err != nil {
+				t.Fatalf("queue operation: %s", err)
+			}
+		}
+
+		queue(add)
+		flushed := make(chan struct{})
+		go func() {
+			outbox.flush()
+			close(flushed)
+		}()
+
+		select {
+		case <-provider.started:
+		case <-time.After(testServerWait):
+			t.Fatal("outbox didn't apply the operation")
+		}
+
+		queue(!add)
+		close(provider.release)
+		<-flushed
+
+		entries, err := PendingOperations("host1")
+		if err != nil {
+			t.Fatalf("get pending operations: %s", err)
+		}
+
+		if len(entries) != 1 {
+			t.Fatalf("add %t: expected the operation queued meanwhile to be pending, got %d entries", add, len(entries))
+		}
+
+		pending := entries[0].Deletes
+		if !add {
+			pending = entries[0].Adds
+		}
+		if len(pending) != 1 || pending[0] != record || len(entries[0].Adds)+len(entries[0].Deletes) != 1 {
+			t.Fatalf("add %t: unexpected pending entry %+v", add, entries[0])
+		}
+
+		outbox.flush()
+		if entries, _ := PendingOperations("host1"); len(entries) != 0 {
+			t.Errorf("add %t: operations still pending after flush: %+v", add, entries[0])
+		}
+
+		applied := provider.deletes
+		if !add {
+			applied = provider.adds
+		}
+		if len(applied) != 1 || applied[0] != record {
+			t.Errorf("add %t: the operation queued meanwhile was not applied, adds %v deletes %v", add, provider.adds, provider.deletes)
+		}
+	}
+}
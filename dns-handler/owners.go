@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+)
+
+// the owner registry records which containers publish a domain, as
+// <RecordOwnersStorePath>/<fqdn>/<type>-<owner> holding the record
+func ownerDir(record Record) string {
+	return filepath.Join(config.RecordOwnersStorePath, strings.ToLower(trimDot(record.FQDN())))
+}
+
+func ownerKey(record Record) string {
+	return filepath.Join(ownerDir(record), record.Type+"-"+record.Owner)
+}
+
+func setOwner(record Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return db.SetKey(ownerKey(record), string(value))
+}
+
+// releaseOwner drops the ownership of record and returns the records of the
+// owners left on the domain
+func releaseOwner(record Record) ([]Record, error) {
+	if err := db.DeleteKey(ownerKey(record)); err != nil && !client.IsKeyNotFound(err) {
+		return nil, err
+	}
+
+	remaining, err := ownedRecords(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(remaining) == 0 {
+		db.DeleteKey(ownerDir(record))
+	}
+
+	return remaining, nil
+}
+
+// ownedRecords returns the records of every owner of the domain of record
+func ownedRecords(record Record) ([]Record, error) {
+	nodes, err := db.GetKeys(ownerDir(record))
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var records []Record
+	for _, node := range nodes {
+		var owned Record
+		if err := json.Unmarshal([]byte(node.Value), &owned); err != nil {
+			log.Warnf("skip invalid record owner %s: %s", node.Key, err.Error())
+			continue
+		}
+		records = append(records, owned)
+	}
+
+	return records, nil
+}
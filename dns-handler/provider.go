@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	ProviderConsole     = "console"
+	ProviderSkyDNS      = "skydns"
+	ProviderCoreDNSEtcd = "coredns-etcd"
+	ProviderRFC2136     = "rfc2136"
+	ProviderNone        = "none"
+
+	RecordTypeA     = "A"
+	RecordTypeAAAA  = "AAAA"
+	RecordTypeCNAME = "CNAME"
+	RecordTypePTR   = "PTR"
+	RecordTypeSRV   = "SRV"
+
+	DefaultEtcdPrefix = "/skydns"
+)
+
+// ErrListNotSupported is returned by providers whose backend can not
+// enumerate the records of a zone.
+var ErrListNotSupported = errors.New("the dns provider does not support listing records")
+
+// Record is a single resource record of a container domain. Name is relative
+// to Zone, Value is the rdata: an address for A/AAAA and a domain name for
+// CNAME/PTR and the target of SRV. TTL zero means the backend default.
+type Record struct {
+	Name  string
+	Zone  string
+	Type  string
+	Value string
+	TTL   uint32 `json:",omitempty"`
+
+	// Owner is the container the record belongs to. Backends use it to keep
+	// the records of other containers sharing the name when this one goes.
+	Owner string `json:",omitempty"`
+
+	// Port, Priority and Weight are only used by SRV records
+	Port     int `json:",omitempty"`
+	Priority int `json:",omitempty"`
+	Weight   int `json:",omitempty"`
+}
+
+func (r Record) FQDN() string {
+	return r.Name + "." + r.Zone
+}
+
+func (r Record) String() string {
+	if r.Type == RecordTypeSRV {
+		return fmt.Sprintf("%s %s %d %d %d %s", r.FQDN(), r.Type, r.Priority, r.Weight, r.Port, r.Value)
+	}
+	return fmt.Sprintf("%s %s %s", r.FQDN(), r.Type, r.Value)
+}
+
+// Provider publishes container records into a DNS backend.
+type Provider interface {
+	AddRecord(record Record) error
+	DeleteRecord(record Record) error
+	ListRecords(zone string) ([]Record, error)
+}
+
+type ProviderConfig struct {
+	// Name selects the backend: console, skydns, coredns-etcd, rfc2136 or none
+	Name string
+
+	// Endpoint is the url of the dns console
+	Endpoint string
+
+	// Auth holds the credentials of the dns console
+	Auth AuthConfig
+
+	// EtcdPrefix is the key prefix the skydns message format is written under
+	EtcdPrefix string
+
+	RFC2136 RFC2136Config
+}
+
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Name {
+	case ProviderConsole:
+		authenticator, err := NewAuthenticator(cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		return &DNSClient{Endpoint: cfg.Endpoint, Authenticator: authenticator}, nil
+	case ProviderSkyDNS, ProviderCoreDNSEtcd:
+		// the etcd plugin of CoreDNS reads the SkyDNS message format, both
+		// backends share one implementation
+		prefix := cfg.EtcdPrefix
+		if prefix == "" {
+			prefix = DefaultEtcdPrefix
+		}
+		return &SkyDNSProvider{Prefix: prefix}, nil
+	case ProviderRFC2136:
+		return NewRFC2136Provider(cfg.RFC2136)
+	case ProviderNone:
+		return &NoneProvider{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown dns provider %s", cfg.Name)
+}
+
+// AddressRecordType returns the record type holding the given ip address
+func AddressRecordType(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed != nil && parsed.To4() == nil {
+		return RecordTypeAAAA
+	}
+
+	return RecordTypeA
+}
+
+// NoneProvider drops every record, it is used to run july without DNS.
+type NoneProvider struct {
+}
+
+func (p *NoneProvider) AddRecord(record Record) error {
+	return nil
+}
+
+func (p *NoneProvider) DeleteRecord(record Record) error {
+	return nil
+}
+
+func (p *NoneProvider) ListRecords(zone string) ([]Record, error) {
+	return nil, nil
+}
+
+func trimDot(domain string) string {
+	return strings.TrimSuffix(domain, ".")
+}
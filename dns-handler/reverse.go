@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	mdns "github.com/miekg/dns"
+)
+
+// ReverseZone returns the in-addr.arpa/ip6.arpa zone of the subnet ip/mask,
+// cut at the last full octet (nibble for IPv6) covered by the mask, e.g.
+// 10.1.2.5/22 lives in 1.10.in-addr.arpa.
+func ReverseZone(ip string, mask int) (string, error) {
+	reverseName, err := mdns.ReverseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+
+	labels := mdns.SplitDomainName(reverseName)
+	hostLabels, keep := 4, mask/8
+	if net.ParseIP(ip).To4() == nil {
+		hostLabels, keep = 32, mask/4
+	}
+
+	if keep < 1 {
+		keep = 1
+	}
+
+	if keep >= hostLabels {
+		keep = hostLabels - 1
+	}
+
+	return mdns.Fqdn(strings.Join(labels[hostLabels-keep:], ".")), nil
+}
+
+// PTRRecord builds the reverse record of ip inside reverseZone pointing
+// back to target
+func PTRRecord(ip, reverseZone, target string) (Record, error) {
+	reverseName, err := mdns.ReverseAddr(ip)
+	if err != nil {
+		return Record{}, err
+	}
+
+	suffix := "." + mdns.Fqdn(reverseZone)
+	if !strings.HasSuffix(reverseName, suffix) {
+		return Record{}, fmt.Errorf("ip %s is not inside reverse zone %s", ip, reverseZone)
+	}
+
+	return Record{
+		Name:  strings.TrimSuffix(reverseName, suffix),
+		Zone:  mdns.Fqdn(reverseZone),
+		Type:  RecordTypePTR,
+		Value: mdns.Fqdn(target),
+	}, nil
+}
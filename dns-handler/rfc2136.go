@@ -0,0 +1,244 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	mdns "github.com/miekg/dns"
+)
+
+const (
+	DefaultRFC2136TTL    = 60
+	DefaultTSIGAlgorithm = "hmac-sha256"
+)
+
+var tsigAlgorithms = map[string]string{
+	"hmac-md5":    mdns.HmacMD5,
+	"hmac-sha1":   mdns.HmacSHA1,
+	"hmac-sha256": mdns.HmacSHA256,
+	"hmac-sha512": mdns.HmacSHA512,
+}
+
+type RFC2136Config struct {
+	// Server is the host:port of the primary accepting dynamic updates
+	Server string
+
+	// Zone is the zone the updates are sent for, it defaults to the zone of
+	// each record
+	Zone string
+
+	TSIGKeyName   string
+	TSIGSecret    string
+	TSIGAlgorithm string
+
+	TTL uint32
+}
+
+// RFC2136Provider publishes records through authenticated dynamic updates
+// (RFC 2136 + TSIG), as accepted by BIND, PowerDNS and friends.
+type RFC2136Provider struct {
+	config RFC2136Config
+	client *mdns.Client
+}
+
+func NewRFC2136Provider(config RFC2136Config) (*RFC2136Provider, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("rfc2136 dns provider requires a server")
+	}
+
+	if _, _, err := net.SplitHostPort(config.Server); err != nil {
+		config.Server = net.JoinHostPort(config.Server, "53")
+	}
+
+	if config.TTL == 0 {
+		config.TTL = DefaultRFC2136TTL
+	}
+
+	client := &mdns.Client{Net: "tcp", Timeout: 5 * time.Second}
+	if config.TSIGKeyName != "" {
+		if config.TSIGAlgorithm == "" {
+			config.TSIGAlgorithm = DefaultTSIGAlgorithm
+		}
+
+		algorithm, ok := tsigAlgorithms[strings.ToLower(config.TSIGAlgorithm)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tsig algorithm %s", config.TSIGAlgorithm)
+		}
+
+		config.TSIGKeyName = mdns.Fqdn(config.TSIGKeyName)
+		config.TSIGAlgorithm = algorithm
+		client.TsigSecret = map[string]string{config.TSIGKeyName: config.TSIGSecret}
+	}
+
+	return &RFC2136Provider{config: config, client: client}, nil
+}
+
+func (p *RFC2136Provider) AddRecord(record Record) error {
+	rr, err := p.resourceRecord(record)
+	if err != nil {
+		return err
+	}
+
+	if err := p.update(p.zone(record), func(m *mdns.Msg) { m.Insert([]mdns.RR{rr}) }); err != nil {
+		return err
+	}
+
+	log.Infof("rfc2136 add record %s", record)
+	return nil
+}
+
+func (p *RFC2136Provider) DeleteRecord(record Record) error {
+	rr, err := p.resourceRecord(record)
+	if err != nil {
+		return err
+	}
+
+	// only the rr with this exact rdata is removed, other addresses of the
+	// same name stay untouched
+	if err := p.update(p.zone(record), func(m *mdns.Msg) { m.Remove([]mdns.RR{rr}) }); err != nil {
+		return err
+	}
+
+	log.Infof("rfc2136 delete record %s", record)
+	return nil
+}
+
+// ListRecords transfers the zone with AXFR and returns its address and
+// alias records
+func (p *RFC2136Provider) ListRecords(zone string) ([]Record, error) {
+	m := new(mdns.Msg)
+	m.SetAxfr(mdns.Fqdn(zone))
+	p.sign(m)
+
+	transfer := &mdns.Transfer{TsigSecret: p.client.TsigSecret}
+	envelopes, err := transfer.In(m, p.config.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+
+		for _, rr := range envelope.RR {
+			if record, ok := fromResourceRecord(rr, zone); ok {
+				records = append(records, record)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func (p *RFC2136Provider) zone(record Record) string {
+	// reverse records always live in the reverse zone derived from the pool
+	if p.config.Zone != "" && record.Type != RecordTypePTR {
+		return mdns.Fqdn(p.config.Zone)
+	}
+
+	return mdns.Fqdn(record.Zone)
+}
+
+func (p *RFC2136Provider) update(zone string, fill func(m *mdns.Msg)) error {
+	m := new(mdns.Msg)
+	m.SetUpdate(zone)
+	fill(m)
+	p.sign(m)
+
+	resp, _, err := p.client.Exchange(m, p.config.Server)
+	if err != nil {
+		return err
+	}
+
+	if resp.Rcode != mdns.RcodeSuccess {
+		return fmt.Errorf("dynamic update of zone %s failed: %s", zone, mdns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
+
+func (p *RFC2136Provider) sign(m *mdns.Msg) {
+	if p.config.TSIGKeyName != "" {
+		m.SetTsig(p.config.TSIGKeyName, p.config.TSIGAlgorithm, 300, time.Now().Unix())
+	}
+}
+
+func (p *RFC2136Provider) resourceRecord(record Record) (mdns.RR, error) {
+	header := mdns.RR_Header{
+		Name:   mdns.Fqdn(record.FQDN()),
+		Class:  mdns.ClassINET,
+		Ttl:    p.config.TTL,
+		Rrtype: mdns.StringToType[record.Type],
+	}
+
+	if record.TTL != 0 {
+		header.Ttl = record.TTL
+	}
+
+	switch record.Type {
+	case RecordTypeA, RecordTypeAAAA:
+		ip := net.ParseIP(record.Value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %s of record %s", record.Value, record.FQDN())
+		}
+
+		if record.Type == RecordTypeA {
+			return &mdns.A{Hdr: header, A: ip.To4()}, nil
+		}
+		return &mdns.AAAA{Hdr: header, AAAA: ip}, nil
+	case RecordTypeCNAME:
+		return &mdns.CNAME{Hdr: header, Target: mdns.Fqdn(record.Value)}, nil
+	case RecordTypePTR:
+		return &mdns.PTR{Hdr: header, Ptr: mdns.Fqdn(record.Value)}, nil
+	case RecordTypeSRV:
+		return &mdns.SRV{
+			Hdr:      header,
+			Priority: uint16(record.Priority),
+			Weight:   uint16(record.Weight),
+			Port:     uint16(record.Port),
+			Target:   mdns.Fqdn(record.Value),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported record type %s", record.Type)
+}
+
+func fromResourceRecord(rr mdns.RR, zone string) (Record, bool) {
+	header := rr.Header()
+	suffix := "." + mdns.Fqdn(zone)
+	if !strings.HasSuffix(header.Name, suffix) {
+		return Record{}, false
+	}
+
+	record := Record{
+		Name: strings.TrimSuffix(header.Name, suffix),
+		Zone: zone,
+		Type: mdns.TypeToString[header.Rrtype],
+		TTL:  header.Ttl,
+	}
+
+	switch v := rr.(type) {
+	case *mdns.A:
+		record.Value = v.A.String()
+	case *mdns.AAAA:
+		record.Value = v.AAAA.String()
+	case *mdns.CNAME:
+		record.Value = v.Target
+	case *mdns.PTR:
+		record.Value = v.Ptr
+	case *mdns.SRV:
+		record.Value = v.Target
+		record.Port = int(v.Port)
+		record.Priority = int(v.Priority)
+		record.Weight = int(v.Weight)
+	default:
+		return Record{}, false
+	}
+
+	return record, true
+}
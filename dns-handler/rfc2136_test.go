@@ -0,0 +1,235 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+)
+
+const (
+	testZone       = "example.com."
+	testKeyName    = "july-key."
+	testKeySecret  = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+	testWrongKey   = "d3Jvbmctd3Jvbmctd3Jvbmc="
+	testTSIGFudge  = 300
+	testServerWait = 5 * time.Second
+)
+
+// updateServer is an in-process authoritative server of testZone accepting
+// TSIG signed dynamic updates and zone transfers
+type updateServer struct {
+	sync.Mutex
+	records []mdns.RR
+	server  *mdns.Server
+	addr    string
+}
+
+func startUpdateServer(t *testing.T) *updateServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	s := &updateServer{addr: listener.Addr().String()}
+	started := make(chan struct{})
+	s.server = &mdns.Server{
+		Listener:          listener,
+		Handler:           mdns.HandlerFunc(s.serveDNS),
+		TsigSecret:        map[string]string{testKeyName: testKeySecret},
+		NotifyStartedFunc: func() { close(started) },
+	}
+
+	go s.server.ActivateAndServe()
+	select {
+	case <-started:
+	case <-time.After(testServerWait):
+		t.Fatal("dns server didn't start")
+	}
+
+	return s
+}
+
+func (s *updateServer) stop() {
+	s.server.Shutdown()
+}
+
+func (s *updateServer) serveDNS(w mdns.ResponseWriter, r *mdns.Msg) {
+	m := new(mdns.Msg)
+	m.SetReply(r)
+
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.SetRcode(r, mdns.RcodeNotAuth)
+		w.WriteMsg(m)
+		return
+	}
+
+	switch {
+	case r.Opcode == mdns.OpcodeUpdate:
+		s.update(r.Ns)
+	case len(r.Question) == 1 && r.Question[0].Qtype == mdns.TypeAXFR:
+		soa, _ := mdns.NewRR(testZone + " 60 IN SOA ns.example.com. admin.example.com. 1 60 60 60 60")
+		s.Lock()
+		m.Answer = append(append([]mdns.RR{soa}, s.records...), soa)
+		s.Unlock()
+	default:
+		m.SetRcode(r, mdns.RcodeRefused)
+	}
+
+	m.SetTsig(testKeyName, mdns.HmacSHA256, testTSIGFudge, time.Now().Unix())
+	w.WriteMsg(m)
+}
+
+// update applies the update section: class INET adds a rr, class NONE
+// removes the rr with the same rdata
+func (s *updateServer) update(rrs []mdns.RR) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, rr := range rrs {
+		if rr.Header().Class == mdns.ClassNONE {
+			var left []mdns.RR
+			for _, r := range s.records {
+				if !sameRdata(r, rr) {
+					left = append(left, r)
+				}
+			}
+			s.records = left
+			continue
+		}
+
+		s.records = append(s.records, rr)
+	}
+}
+
+func (s *updateServer) has(rr string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	want, _ := mdns.NewRR(rr)
+	for _, r := range s.records {
+		if sameRdata(r, want) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *updateServer) count() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.records)
+}
+
+func sameRdata(a, b mdns.RR) bool {
+	ha, hb := *a.Header(), *b.Header()
+	ha.Class, hb.Class, ha.Ttl, hb.Ttl, ha.Rdlength, hb.Rdlength = 0, 0, 0, 0, 0, 0
+	return ha == hb && rdata(a) == rdata(b)
+}
+
+func rdata(rr mdns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+func newTestProvider(t *testing.T, addr, secret string) *RFC2136Provider {
+	provider, err := NewRFC2136Provider(RFC2136Config{
+		Server:        addr,
+		TSIGKeyName:   testKeyName,
+		TSIGSecret:    secret,
+		TSIGAlgorithm: DefaultTSIGAlgorithm,
+	})
+	if err != nil {
+		t.Fatalf("create provider: %s", err)
+	}
+
+	return provider
+}
+
+func TestRFC2136AddDeleteRecord(t *testing.T) {
+	server := startUpdateServer(t)
+	defer server.stop()
+
+	provider := newTestProvider(t, server.addr, testKeySecret)
+	web1 := Record{Name: "web", Zone: "example.com", Type: RecordTypeA, Value: "192.168.1.10"}
+	web2 := Record{Name: "web", Zone: "example.com", Type: RecordTypeA, Value: "192.168.1.11"}
+
+	for _, record := range []Record{web1, web2} {
+		if err := provider.AddRecord(record); err != nil {
+			t.Fatalf("add record %s: %s", record, err)
+		}
+	}
+
+	if !server.has("web.example.com. 60 IN A 192.168.1.10") || !server.has("web.example.com. 60 IN A 192.168.1.11") {
+		t.Fatalf("records not added, server has %d records", server.count())
+	}
+
+	if err := provider.DeleteRecord(web1); err != nil {
+		t.Fatalf("delete record %s: %s", web1, err)
+	}
+
+	if server.has("web.example.com. 60 IN A 192.168.1.10") {
+		t.Error("deleted record is still served")
+	}
+
+	if !server.has("web.example.com. 60 IN A 192.168.1.11") {
+		t.Error("the other address of the name was deleted too")
+	}
+}
+
+func TestRFC2136RejectsBadKey(t *testing.T) {
+	server := startUpdateServer(t)
+	defer server.stop()
+
+	provider := newTestProvider(t, server.addr, testWrongKey)
+	err := provider.AddRecord(Record{Name: "web", Zone: "example.com", Type: RecordTypeA, Value: "192.168.1.10"})
+	if err == nil {
+		t.Fatal("update signed with a wrong key succeeded")
+	}
+
+	if !strings.Contains(err.Error(), "NOTAUTH") {
+		t.Errorf("expected a NOTAUTH error, got %s", err)
+	}
+
+	if server.count() != 0 {
+		t.Error("rejected update changed the zone")
+	}
+}
+
+func TestRFC2136ListRecords(t *testing.T) {
+	server := startUpdateServer(t)
+	defer server.stop()
+
+	provider := newTestProvider(t, server.addr, testKeySecret)
+	added := []Record{
+		{Name: "web", Zone: "example.com", Type: RecordTypeA, Value: "192.168.1.10", TTL: DefaultRFC2136TTL},
+		{Name: "www", Zone: "example.com", Type: RecordTypeCNAME, Value: "web.example.com.", TTL: DefaultRFC2136TTL},
+		{Name: "_http._tcp.web", Zone: "example.com", Type: RecordTypeSRV, Value: "web.example.com.",
+			Port: 80, Priority: 10, Weight: 5, TTL: DefaultRFC2136TTL},
+	}
+
+	for _, record := range added {
+		if err := provider.AddRecord(record); err != nil {
+			t.Fatalf("add record %s: %s", record, err)
+		}
+	}
+
+	records, err := provider.ListRecords("example.com")
+	if err != nil {
+		t.Fatalf("list records: %s", err)
+	}
+
+	if len(records) != len(added) {
+		t.Fatalf("expected %d records, got %d: %v", len(added), len(records), records)
+	}
+
+	for i, record := range added {
+		if records[i] != record {
+			t.Errorf("record %d: expected %+v, got %+v", i, record, records[i])
+		}
+	}
+}
@@ -2,10 +2,14 @@ package dns
 
 import (
 	"encoding/json"
-	"path/filepath"
+	"net"
+	"path"
 	"strings"
 
 	"github.com/upccup/july/db"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
 )
 
 // From https://github.com/skynetservices/skydns/blob/master/msg/service.go#L23
@@ -52,15 +56,125 @@ func reverse(ss []string) {
 	return
 }
 
-func AddDNSRecord(zone, domain, ip string) error {
-	value, err := json.Marshal(Service{Host: ip})
+// SkyDNSProvider writes records in the SkyDNS message format into the
+// cluster store, e.g. web.example.com is stored as <prefix>/com/example/web.
+type SkyDNSProvider struct {
+	Prefix string
+}
+
+// unownedLabel is the key label of the address records without owner, a
+// name must stay a directory for the SRV records under it
+const unownedLabel = "x1"
+
+// key of an owned record gets one more label with the owner, so every
+// replica sharing a name has its own key and SkyDNS answers with all of them
+func (p *SkyDNSProvider) key(record Record) string {
+	key := path.Join(p.Prefix, Reverse(trimDot(record.FQDN())))
+	if ownerKeyed(record) {
+		key = path.Join(key, ownerLabel(record.Owner))
+	} else if record.Type == RecordTypeA || record.Type == RecordTypeAAAA {
+		key = path.Join(key, unownedLabel)
+	}
+
+	return key
+}
+
+func (p *SkyDNSProvider) AddRecord(record Record) error {
+	service := Service{
+		Host:     trimDot(record.Value),
+		Port:     record.Port,
+		Priority: record.Priority,
+		Weight:   record.Weight,
+		Ttl:      record.TTL,
+	}
+
+	if ownerKeyed(record) {
+		service.Group = strings.ToLower(trimDot(record.FQDN()))
+	}
+
+	value, err := json.Marshal(service)
 	if err != nil {
 		return err
 	}
 
-	return db.SetKey(filepath.Join(zone, Reverse(domain)), string(value))
+	return db.SetKey(p.key(record), string(value))
+}
+
+func (p *SkyDNSProvider) DeleteRecord(record Record) error {
+	// a record which is already gone is deleted as far as we are concerned
+	if err := db.DeleteKey(p.key(record)); err != nil && !client.IsKeyNotFound(err) {
+		return err
+	}
+
+	return nil
 }
 
-func RemoveDNSRecord(zone, domain string) error {
-	return db.DeleteKey(filepath.Join(zone, Reverse(domain)))
+func (p *SkyDNSProvider) ListRecords(zone string) ([]Record, error) {
+	zoneKey := path.Join(p.Prefix, Reverse(trimDot(zone)))
+	nodes, err := db.GetKeysRecursive(zoneKey)
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var records []Record
+	for _, node := range nodes {
+		var service Service
+		if err := json.Unmarshal([]byte(node.Value), &service); err != nil {
+			log.Warnf("skip invalid skydns record %s: %s", node.Key, err.Error())
+			continue
+		}
+
+		labels := strings.Split(strings.TrimPrefix(strings.TrimPrefix(node.Key, zoneKey), "/"), "/")
+		reverse(labels)
+
+		var owner string
+		if service.Group != "" && len(labels) > 1 {
+			owner, labels = labels[0], labels[1:]
+		} else if labels[0] == unownedLabel && len(labels) > 1 && net.ParseIP(service.Host) != nil {
+			labels = labels[1:]
+		}
+
+		record := Record{
+			Owner:    owner,
+			Name:     strings.Join(labels, "."),
+			Zone:     zone,
+			Type:     AddressRecordType(service.Host),
+			Value:    service.Host,
+			TTL:      service.Ttl,
+			Port:     service.Port,
+			Priority: service.Priority,
+			Weight:   service.Weight,
+		}
+
+		if service.Port != 0 {
+			record.Type = RecordTypeSRV
+		} else if net.ParseIP(service.Host) == nil {
+			record.Type = RecordTypeCNAME
+			if strings.HasSuffix(trimDot(zone), ".arpa") {
+				record.Type = RecordTypePTR
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// ownerKeyed tells whether the key of record has the owner label. PTR
+// records are looked up by the exact key of the reverse name, an address
+// has a single owner anyway.
+func ownerKeyed(record Record) bool {
+	return record.Owner != "" && record.Type != RecordTypePTR
+}
+
+func ownerLabel(owner string) string {
+	if len(owner) > 12 {
+		return owner[:12]
+	}
+
+	return owner
 }
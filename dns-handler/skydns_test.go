@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSkyDNSPTRRecordKey(t *testing.T) {
+	store := startStore(t)
+	provider := &SkyDNSProvider{Prefix: DefaultEtcdPrefix}
+
+	record, err := PTRRecord("192.168.1.10", "1.168.192.in-addr.arpa", "web.example.com")
+	if err != nil {
+		t.Fatalf("build ptr record: %s", err)
+	}
+	record.Owner = "0123456789abcdef"
+
+	if err := provider.AddRecord(record); err != nil {
+		t.Fatalf("add record %s: %s", record, err)
+	}
+
+	// SkyDNS and CoreDNS answer a reverse lookup from the key of the name
+	key := "/skydns/arpa/in-addr/192/168/1/10"
+	value, ok := store.get(key)
+	if !ok {
+		t.Fatalf("ptr record not stored at %s, store has %v", key, store.keys)
+	}
+
+	var service Service
+	if err := json.Unmarshal([]byte(value), &service); err != nil {
+		t.Fatalf("unmarshal %s: %s", value, err)
+	}
+
+	if service.Host != "web.example.com" {
+		t.Errorf("expected host web.example.com, got %s", service.Host)
+	}
+
+	records, err := provider.ListRecords(record.Zone)
+	if err != nil {
+		t.Fatalf("list records: %s", err)
+	}
+
+	if len(records) != 1 || records[0].Name != "10" || records[0].Type != RecordTypePTR {
+		t.Errorf("expected the ptr record of 10, got %+v", records)
+	}
+
+	if err := provider.DeleteRecord(record); err != nil {
+		t.Fatalf("delete record %s: %s", record, err)
+	}
+
+	if _, ok := store.get(key); ok {
+		t.Error("deleted ptr record is still stored")
+	}
+}
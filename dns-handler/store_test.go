@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/upccup/july/db"
+)
+
+// memoryStore serves the etcd v2 keys api from memory, enough of it for the
+// get, set and delete calls of the db package
+type memoryStore struct {
+	sync.Mutex
+	server *httptest.Server
+	keys   map[string]string
+}
+
+type storeNode struct {
+	Key   string       `json:"key"`
+	Value string       `json:"value,omitempty"`
+	Dir   bool         `json:"dir,omitempty"`
+	Nodes []*storeNode `json:"nodes,omitempty"`
+}
+
+func startStore(t *testing.T) *memoryStore {
+	s := &memoryStore{keys: make(map[string]string)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	db.SetDBAddr(s.server.URL)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *memoryStore) get(key string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	value, ok := s.keys[key]
+	return value, ok
+}
+
+func (s *memoryStore) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	key := "/" + strings.Trim(strings.TrimPrefix(r.URL.Path, "/v2/keys"), "/")
+
+	s.Lock()
+	defer s.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Etcd-Index", "1")
+	switch r.Method {
+	case "GET":
+		node := s.node(key, r.URL.Query().Get("recursive") == "true", true)
+		if node == nil {
+			storeError(w, http.StatusNotFound, 100, "Key not found", key)
+			return
+		}
+		storeReply(w, http.StatusOK, "get", node)
+	case "PUT":
+		r.ParseForm()
+		if s.node(key, false, false) != nil && s.node(key, false, false).Dir {
+			storeError(w, http.StatusForbidden, 102, "Not a file", key)
+			return
+		}
+		for dir := parentDir(key); dir != "/"; dir = parentDir(dir) {
+			if _, ok := s.keys[dir]; ok {
+				storeError(w, http.StatusForbidden, 104, "Not a directory", dir)
+				return
+			}
+		}
+		s.keys[key] = r.Form.Get("value")
+		storeReply(w, http.StatusOK, "set", &storeNode{Key: key, Value: s.keys[key]})
+	case "DELETE":
+		if s.node(key, false, false) == nil {
+			storeError(w, http.StatusNotFound, 100, "Key not found", key)
+			return
+		}
+		for k := range s.keys {
+			if k == key || strings.HasPrefix(k, key+"/") {
+				delete(s.keys, k)
+			}
+		}
+		storeReply(w, http.StatusOK, "delete", &storeNode{Key: key})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// node returns the leaf or the directory at key, nil when there is none. A
+// directory lists its children, their children too when recursive.
+func (s *memoryStore) node(key string, recursive, children bool) *storeNode {
+	if value, ok := s.keys[key]; ok {
+		return &storeNode{Key: key, Value: value}
+	}
+
+	names := make(map[string]bool)
+	for k := range s.keys {
+		if strings.HasPrefix(k, key+"/") || key == "/" {
+			rest := strings.TrimPrefix(strings.TrimPrefix(k, key), "/")
+			names[strings.SplitN(rest, "/", 2)[0]] = true
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	dir := &storeNode{Key: key, Dir: true}
+	if !children {
+		return dir
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		child := s.node(strings.TrimSuffix(key, "/")+"/"+name, recursive, recursive)
+		dir.Nodes = append(dir.Nodes, child)
+	}
+
+	return dir
+}
+
+func parentDir(key string) string {
+	i := strings.LastIndex(key, "/")
+	if i <= 0 {
+		return "/"
+	}
+
+	return key[:i]
+}
+
+func storeReply(w http.ResponseWriter, status int, action string, node *storeNode) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"action": action, "node": node})
+}
+
+func storeError(w http.ResponseWriter, status, code int, message, cause string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errorCode": code, "message": message, "cause": cause, "index": 1})
+}
@@ -0,0 +1,263 @@
+package dnsserver
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+	event "github.com/upccup/july/docker-event"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+	mdns "github.com/miekg/dns"
+)
+
+// recordCache mirrors the ContainerIPInfo stored under
+// ContainerDomainsStorePath and the swarm service tasks stored under
+// ServiceDomainsStorePath, and indexes them by query name
+type recordCache struct {
+	sync.RWMutex
+	containers    map[string]*event.ContainerIPInfo
+	swarmServices map[string]*event.ServiceInfo
+
+	addresses map[string][]net.IP
+	pointers  map[string][]string
+	services  map[string][]*mdns.SRV
+	aliases   map[string]string
+
+	// serial is the store index of the last change, used as SOA serial
+	serial uint32
+}
+
+func newRecordCache() *recordCache {
+	return &recordCache{
+		containers:    make(map[string]*event.ContainerIPInfo),
+		swarmServices: make(map[string]*event.ServiceInfo),
+	}
+}
+
+// run keeps the cache in sync with the container and the service domains
+// forever
+func (c *recordCache) run() {
+	go c.sync(config.ServiceDomainsStorePath)
+	c.sync(config.ContainerDomainsStorePath)
+}
+
+// sync mirrors one store dir: a full load followed by a watch, and a reload
+// whenever the watch breaks
+func (c *recordCache) sync(dir string) {
+	for {
+		index, err := c.load(dir)
+		if err != nil {
+			log.Errorf("load domains of %s failed. Error: %s", dir, err.Error())
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		err = db.WatchKeys(dir, index, c.apply)
+		log.Warnf("watch domains of %s stopped, reload them. Error: %v", dir, err)
+	}
+}
+
+func (c *recordCache) load(dir string) (uint64, error) {
+	nodes, index, err := db.GetKeysWithIndex(dir)
+	if err != nil && !client.IsKeyNotFound(err) {
+		return 0, err
+	}
+
+	if clusterErr, ok := err.(client.Error); ok {
+		index = clusterErr.Index
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if dir == config.ServiceDomainsStorePath {
+		c.swarmServices = make(map[string]*event.ServiceInfo)
+	} else {
+		c.containers = make(map[string]*event.ContainerIPInfo)
+	}
+
+	for _, node := range nodes {
+		c.set(node)
+	}
+
+	c.setSerial(index)
+	c.rebuild()
+	log.Infof("loaded %d domains of %s into the dns cache", len(nodes), dir)
+	return index, nil
+}
+
+func (c *recordCache) apply(resp *client.Response) {
+	c.Lock()
+	defer c.Unlock()
+
+	switch resp.Action {
+	case "delete", "expire", "compareAndDelete":
+		id := filepath.Base(resp.Node.Key)
+		if isServiceKey(resp.Node.Key) {
+			delete(c.swarmServices, id)
+		} else {
+			delete(c.containers, id)
+		}
+	default:
+		c.set(resp.Node)
+	}
+
+	c.setSerial(resp.Index)
+	c.rebuild()
+}
+
+// set stores the container or service domain of node, callers must hold the
+// write lock
+func (c *recordCache) set(node *client.Node) {
+	id := filepath.Base(node.Key)
+	if isServiceKey(node.Key) {
+		var service event.ServiceInfo
+		if err := json.Unmarshal([]byte(node.Value), &service); err != nil {
+			log.Warnf("skip invalid service domain %s: %s", node.Key, err.Error())
+			return
+		}
+		c.swarmServices[id] = &service
+		return
+	}
+
+	if ipInfo := decode(node); ipInfo != nil {
+		c.containers[id] = ipInfo
+	}
+}
+
+// setSerial keeps the SOA serial growing, the two stores are watched at
+// their own index
+func (c *recordCache) setSerial(index uint64) {
+	if uint32(index) > c.serial {
+		c.serial = uint32(index)
+	}
+}
+
+// rebuild recomputes the name indexes, callers must hold the write lock
+func (c *recordCache) rebuild() {
+	c.addresses = make(map[string][]net.IP)
+	c.pointers = make(map[string][]string)
+	c.services = make(map[string][]*mdns.SRV)
+	c.aliases = make(map[string]string)
+
+	infos := make([]*event.ContainerIPInfo, 0, len(c.containers))
+	for _, ipInfo := range c.containers {
+		infos = append(infos, ipInfo)
+	}
+
+	for _, service := range c.swarmServices {
+		for _, task := range service.Tasks {
+			infos = append(infos, task)
+		}
+	}
+
+	for _, ipInfo := range infos {
+		if ipInfo.Withdrawn || ipInfo.Domain == "" || ipInfo.Zone == "" {
+			continue
+		}
+
+		var ips []net.IP
+		for _, address := range ipInfo.Addresses() {
+			if ip := net.ParseIP(address.IP); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+
+		if len(ips) == 0 {
+			continue
+		}
+
+		for _, domainName := range ipInfo.AllNames() {
+			name := queryName(domainName.FQDN())
+			c.addresses[name] = append(c.addresses[name], ips...)
+		}
+
+		name := queryName(ipInfo.Domain + "." + ipInfo.Zone)
+		for _, alias := range ipInfo.Aliases {
+			c.aliases[queryName(alias.FQDN())] = name
+		}
+
+		for _, ip := range ips {
+			if reverse, err := mdns.ReverseAddr(ip.String()); err == nil {
+				c.pointers[reverse] = append(c.pointers[reverse], name)
+			}
+		}
+
+		for _, port := range ipInfo.Ports {
+			srvName := queryName("_" + port.Name + "._" + port.Proto + "." + name)
+			c.services[srvName] = append(c.services[srvName], &mdns.SRV{
+				Hdr:      mdns.RR_Header{Ttl: ipInfo.TTL},
+				Priority: uint16(ipInfo.Priority),
+				Weight:   uint16(ipInfo.Weight),
+				Port:     uint16(port.Port),
+				Target:   name,
+			})
+		}
+	}
+}
+
+func (c *recordCache) lookupAddresses(name string) []net.IP {
+	c.RLock()
+	defer c.RUnlock()
+	return c.addresses[name]
+}
+
+func (c *recordCache) lookupPointers(name string) []string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.pointers[name]
+}
+
+func (c *recordCache) lookupAlias(name string) string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.aliases[name]
+}
+
+func (c *recordCache) lookupServices(name string) []*mdns.SRV {
+	c.RLock()
+	defer c.RUnlock()
+	return c.services[name]
+}
+
+// exists reports whether any record lives at name, so that an empty answer
+// can be told apart from NXDOMAIN
+func (c *recordCache) exists(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	_, address := c.addresses[name]
+	_, service := c.services[name]
+	_, alias := c.aliases[name]
+	return address || service || alias
+}
+
+func (c *recordCache) soaSerial() uint32 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.serial
+}
+
+func decode(node *client.Node) *event.ContainerIPInfo {
+	var ipInfo event.ContainerIPInfo
+	if err := json.Unmarshal([]byte(node.Value), &ipInfo); err != nil {
+		log.Warnf("skip invalid container domain %s: %s", node.Key, err.Error())
+		return nil
+	}
+
+	return &ipInfo
+}
+
+func isServiceKey(key string) bool {
+	return strings.HasPrefix(key, config.ServiceDomainsStorePath+"/")
+}
+
+func queryName(name string) string {
+	return mdns.Fqdn(strings.ToLower(name))
+}
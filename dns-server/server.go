@@ -0,0 +1,234 @@
+package dnsserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	mdns "github.com/miekg/dns"
+)
+
+const (
+	DefaultTTL        = 30
+	DefaultResolvConf = "/etc/resolv.conf"
+)
+
+type Config struct {
+	// Listen is the address the server answers on, over both udp and tcp
+	Listen string
+
+	// Zones are answered authoritatively from the container domains
+	Zones []string
+
+	// Upstreams receive every query outside Zones, they default to the
+	// nameservers of /etc/resolv.conf
+	Upstreams []string
+
+	TTL uint32
+}
+
+// Server is an authoritative DNS server for the container domains, it
+// forwards everything else to the upstream resolvers.
+type Server struct {
+	config Config
+	cache  *recordCache
+	client *mdns.Client
+}
+
+func NewServer(config Config) (*Server, error) {
+	if len(config.Zones) == 0 {
+		return nil, fmt.Errorf("dns server requires at least one zone")
+	}
+
+	for i, zone := range config.Zones {
+		config.Zones[i] = queryName(zone)
+	}
+
+	if len(config.Upstreams) == 0 {
+		resolvConf, err := mdns.ClientConfigFromFile(DefaultResolvConf)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, server := range resolvConf.Servers {
+			config.Upstreams = append(config.Upstreams, net.JoinHostPort(server, resolvConf.Port))
+		}
+	}
+
+	for i, upstream := range config.Upstreams {
+		if _, _, err := net.SplitHostPort(upstream); err != nil {
+			config.Upstreams[i] = net.JoinHostPort(upstream, "53")
+		}
+	}
+
+	if config.TTL == 0 {
+		config.TTL = DefaultTTL
+	}
+
+	return &Server{
+		config: config,
+		cache:  newRecordCache(),
+		client: &mdns.Client{Timeout: 2 * time.Second},
+	}, nil
+}
+
+// ListenAndServe fills the record cache and serves udp and tcp until one of
+// the listeners fails
+func (s *Server) ListenAndServe() error {
+	go s.cache.run()
+
+	errChan := make(chan error, 2)
+	for _, proto := range []string{"udp", "tcp"} {
+		server := &mdns.Server{Addr: s.config.Listen, Net: proto, Handler: s}
+		go func(server *mdns.Server) {
+			errChan <- server.ListenAndServe()
+		}(server)
+	}
+
+	log.Infof("dns server listen on %s for zones %s", s.config.Listen, strings.Join(s.config.Zones, ", "))
+	return <-errChan
+}
+
+func (s *Server) ServeDNS(w mdns.ResponseWriter, r *mdns.Msg) {
+	if len(r.Question) != 1 {
+		s.reply(w, r, mdns.RcodeFormatError)
+		return
+	}
+
+	question := r.Question[0]
+	name := queryName(question.Name)
+
+	if zone := s.authoritativeZone(name); zone != "" {
+		s.answer(w, r, question, name, zone)
+		return
+	}
+
+	// reverse lookups of container addresses are answered locally, the
+	// rest of the reverse tree belongs to the upstreams
+	if question.Qtype == mdns.TypePTR {
+		if pointers := s.cache.lookupPointers(name); len(pointers) > 0 {
+			m := new(mdns.Msg)
+			m.SetReply(r)
+			m.Authoritative = true
+			for _, target := range pointers {
+				m.Answer = append(m.Answer, &mdns.PTR{Hdr: s.header(name, mdns.TypePTR), Ptr: target})
+			}
+			w.WriteMsg(m)
+			return
+		}
+	}
+
+	s.forward(w, r)
+}
+
+func (s *Server) answer(w mdns.ResponseWriter, r *mdns.Msg, question mdns.Question, name, zone string) {
+	m := new(mdns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	// an alias answers every type with its CNAME followed by the addresses
+	// of the canonical name
+	if target := s.cache.lookupAlias(name); target != "" {
+		m.Answer = []mdns.RR{&mdns.CNAME{Hdr: s.header(name, mdns.TypeCNAME), Target: target}}
+		if question.Qtype == mdns.TypeA || question.Qtype == mdns.TypeAAAA {
+			m.Answer = append(m.Answer, s.addressRecords(target, question.Qtype)...)
+		}
+		w.WriteMsg(m)
+		return
+	}
+
+	switch question.Qtype {
+	case mdns.TypeA, mdns.TypeAAAA:
+		m.Answer = s.addressRecords(name, question.Qtype)
+	case mdns.TypeSRV:
+		for _, service := range s.cache.lookupServices(name) {
+			srv := *service
+			srv.Hdr = s.header(name, mdns.TypeSRV)
+			if service.Hdr.Ttl != 0 {
+				srv.Hdr.Ttl = service.Hdr.Ttl
+			}
+			m.Answer = append(m.Answer, &srv)
+			m.Extra = append(m.Extra, s.addressRecords(srv.Target, mdns.TypeA)...)
+			m.Extra = append(m.Extra, s.addressRecords(srv.Target, mdns.TypeAAAA)...)
+		}
+	case mdns.TypeSOA:
+		if name == zone {
+			m.Answer = []mdns.RR{s.soa(zone)}
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		if name != zone && !s.cache.exists(name) {
+			m.Rcode = mdns.RcodeNameError
+		}
+		m.Ns = []mdns.RR{s.soa(zone)}
+	}
+
+	w.WriteMsg(m)
+}
+
+func (s *Server) addressRecords(name string, qtype uint16) []mdns.RR {
+	var records []mdns.RR
+	for _, ip := range s.cache.lookupAddresses(name) {
+		if ip4 := ip.To4(); ip4 != nil {
+			if qtype == mdns.TypeA {
+				records = append(records, &mdns.A{Hdr: s.header(name, mdns.TypeA), A: ip4})
+			}
+		} else if qtype == mdns.TypeAAAA {
+			records = append(records, &mdns.AAAA{Hdr: s.header(name, mdns.TypeAAAA), AAAA: ip})
+		}
+	}
+
+	return records
+}
+
+func (s *Server) forward(w mdns.ResponseWriter, r *mdns.Msg) {
+	for _, upstream := range s.config.Upstreams {
+		resp, _, err := s.client.Exchange(r, upstream)
+		if err != nil {
+			log.Debugf("forward %s to %s failed. Error: %s", r.Question[0].Name, upstream, err.Error())
+			continue
+		}
+
+		resp.Id = r.Id
+		w.WriteMsg(resp)
+		return
+	}
+
+	s.reply(w, r, mdns.RcodeServerFailure)
+}
+
+func (s *Server) authoritativeZone(name string) string {
+	for _, zone := range s.config.Zones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return zone
+		}
+	}
+
+	return ""
+}
+
+func (s *Server) soa(zone string) mdns.RR {
+	return &mdns.SOA{
+		Hdr:     s.header(zone, mdns.TypeSOA),
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  s.cache.soaSerial(),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  s.config.TTL,
+	}
+}
+
+func (s *Server) header(name string, rrtype uint16) mdns.RR_Header {
+	return mdns.RR_Header{Name: name, Rrtype: rrtype, Class: mdns.ClassINET, Ttl: s.config.TTL}
+}
+
+func (s *Server) reply(w mdns.ResponseWriter, r *mdns.Msg, rcode int) {
+	m := new(mdns.Msg)
+	m.SetRcode(r, rcode)
+	w.WriteMsg(m)
+}
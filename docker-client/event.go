@@ -103,6 +103,20 @@ func (c *Client) AddEventListener(listener chan<- *APIEvents) error {
 	return c.eventMonitor.addListener(listener)
 }
 
+// AddEventListenerSince adds a new listener to container events in the Docker
+// API. When it starts the event monitoring, the events since the given unix
+// time are replayed first.
+func (c *Client) AddEventListenerSince(listener chan<- *APIEvents, since int64) error {
+	var err error
+	if !c.eventMonitor.isEnabled() {
+		err = c.eventMonitor.enableEventMonitoringSince(c, since)
+		if err != nil {
+			return err
+		}
+	}
+	return c.eventMonitor.addListener(listener)
+}
+
 // RemoveEventListener removes a listener from the monitor.
 func (c *Client) RemoveEventListener(listener chan *APIEvents) error {
 	err := c.eventMonitor.removeListener(listener)
@@ -166,11 +180,15 @@ func listenerExists(a chan<- *APIEvents, list *[]chan<- *APIEvents) bool {
 }
 
 func (eventState *eventMonitoringState) enableEventMonitoring(c *Client) error {
+	return eventState.enableEventMonitoringSince(c, 0)
+}
+
+func (eventState *eventMonitoringState) enableEventMonitoringSince(c *Client, since int64) error {
 	eventState.Lock()
 	defer eventState.Unlock()
 	if !eventState.enabled {
 		eventState.enabled = true
-		atomic.StoreInt64(&eventState.lastSeen, 0)
+		atomic.StoreInt64(&eventState.lastSeen, since)
 		eventState.C = make(chan *APIEvents, 100)
 		eventState.errC = make(chan error, 1)
 		go eventState.monitorEvents(c)
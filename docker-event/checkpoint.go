@@ -0,0 +1,190 @@
+package event
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+	docker "github.com/upccup/july/docker-client"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+)
+
+// DefaultReplayWindow is how old a checkpoint may be to resume the events
+// from it, docker only keeps a short history of events to replay
+const DefaultReplayWindow = 10 * time.Minute
+
+const (
+	// replayOverlap is how far back the events are listened to again after
+	// the stream was lost, the client delivers them out of order
+	replayOverlap = 5 * time.Second
+	// recentEventsKept is how long dispatched events are remembered to
+	// drop the ones replayed by the overlap
+	recentEventsKept = time.Minute
+)
+
+// resumePoint returns the unix time to replay the events from. It returns
+// false when there is no recent checkpoint, the records must be reconciled
+// then since events were lost.
+func (listener *DockerListener) resumePoint() (int64, bool) {
+	value, err := db.GetKey(config.GetEventCheckpointStorePath(listener.HostID))
+	if err != nil {
+		if !client.IsKeyNotFound(err) {
+			log.Errorf("get event checkpoint failed. Error: %s", err.Error())
+		}
+		return 0, false
+	}
+
+	timeNano, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Warnf("ignore invalid event checkpoint %s", value)
+		return 0, false
+	}
+
+	window := listener.ReplayWindow
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+
+	lastSeen := time.Unix(0, timeNano)
+	if time.Since(lastSeen) > window {
+		log.Warnf("last event was seen at %s, too long ago to replay", lastSeen.Format(time.RFC3339))
+		return 0, false
+	}
+
+	listener.resumedAt = timeNano
+	listener.lastEvent = timeNano
+	return lastSeen.Unix(), true
+}
+
+// replayed tells whether e was already dispatched: it is at or before the
+// checkpoint resumed from, or it was seen since. The events are not ordered
+// so a live event older than the newest one is not a replay.
+func (listener *DockerListener) replayed(e *docker.APIEvents) bool {
+	if eventTime(e) <= listener.resumedAt {
+		return true
+	}
+
+	return !listener.recent.add(e)
+}
+
+// resubscribePoint is the unix time to listen to the events again from after
+// the stream was lost
+func (listener *DockerListener) resubscribePoint() int64 {
+	since := listener.lastEvent - int64(replayOverlap)
+	if since < listener.resumedAt {
+		since = listener.resumedAt
+	}
+
+	return since / int64(time.Second)
+}
+
+// eventSet remembers the recently dispatched events by type, ID, action and
+// time
+type eventSet struct {
+	seen   map[string]int64
+	pruned int64
+}
+
+// add returns false when e was already added
+func (s *eventSet) add(e *docker.APIEvents) bool {
+	if s.seen == nil {
+		s.seen = make(map[string]int64)
+	}
+
+	timeNano := eventTime(e)
+	key := fmt.Sprintf("%s %s %s %d", e.Type, e.ID, e.Action, timeNano)
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	s.seen[key] = timeNano
+
+	if timeNano-s.pruned > int64(recentEventsKept) {
+		for k, t := range s.seen {
+			if timeNano-t > int64(recentEventsKept) {
+				delete(s.seen, k)
+			}
+		}
+		s.pruned = timeNano
+	}
+
+	return true
+}
+
+// eventTracker follows the events handed to the workers. Since they finish
+// out of order, the checkpoint is the newest time before which every event
+// has been processed.
+type eventTracker struct {
+	sync.Mutex
+	pending    map[int64]int
+	dispatched int64
+	saved      int64
+}
+
+func (t *eventTracker) add(timeNano int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[int64]int)
+	}
+	t.pending[timeNano]++
+	if timeNano > t.dispatched {
+		t.dispatched = timeNano
+	}
+}
+
+// done marks an event processed and returns the checkpoint to save, zero
+// when it didn't move
+func (t *eventTracker) done(timeNano int64) int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.pending[timeNano]--; t.pending[timeNano] <= 0 {
+		delete(t.pending, timeNano)
+	}
+
+	safe := t.dispatched
+	for pending := range t.pending {
+		if pending-1 < safe {
+			safe = pending - 1
+		}
+	}
+
+	if safe <= t.saved {
+		return 0
+	}
+
+	t.saved = safe
+	return safe
+}
+
+// checkpoint records e as processed, saving the new checkpoint of this host
+// when every event before it is processed too
+func (listener *DockerListener) checkpoint(e *docker.APIEvents) {
+	if isRetry(e) {
+		return
+	}
+
+	timeNano := listener.tracker.done(eventTime(e))
+	if timeNano == 0 {
+		return
+	}
+
+	value := strconv.FormatInt(timeNano, 10)
+	if err := db.SetKey(config.GetEventCheckpointStorePath(listener.HostID), value); err != nil {
+		log.Errorf("store event checkpoint %s failed. Error: %s", value, err.Error())
+	}
+}
+
+func eventTime(e *docker.APIEvents) int64 {
+	if e.TimeNano != 0 {
+		return e.TimeNano
+	}
+
+	return e.Time * int64(time.Second)
+}
@@ -0,0 +1,110 @@
+package event
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+
+	docker "github.com/upccup/july/docker-client"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// the reasons GetContainerIPInfo gives no info, skipped containers are the
+// expected ones without a domain, the others are worth a look
+const (
+	ReasonSkippedNoLabels  = "skipped-no-labels"
+	ReasonSkippedNoNetwork = "skipped-no-network"
+	ReasonNoIPYet          = "no-ip-yet"
+	ReasonInspectFailed    = "inspect-failed"
+
+	// a container may be attached to its network after start, its start is
+	// retried after 1s, 2s, 4s... this many times
+	MaxNoIPRetries = 5
+
+	// RetryAttribute marks the start events retried by july, only the dns
+	// hook runs them
+	RetryAttribute = "july.retry"
+)
+
+// containerInfoResults counts the GetContainerIPInfo results by reason
+var containerInfoResults = expvar.NewMap("container_info_results")
+
+type ContainerInfoError struct {
+	Reason string
+	ID     string
+	Err    error
+}
+
+func (e *ContainerInfoError) Error() string {
+	return fmt.Sprintf("container %s: %s: %s", e.ID, e.Reason, e.Err.Error())
+}
+
+func containerInfoError(reason, ID string, err error) error {
+	containerInfoResults.Add(reason, 1)
+	return &ContainerInfoError{Reason: reason, ID: ID, Err: err}
+}
+
+// ErrorReason returns the reason of a GetContainerIPInfo error, empty for
+// other errors
+func ErrorReason(err error) string {
+	if infoErr, ok := err.(*ContainerInfoError); ok {
+		return infoErr.Reason
+	}
+
+	return ""
+}
+
+// logContainerInfoError logs skipped containers at debug level only, so that
+// containers without a domain don't flood the logs
+func logContainerInfoError(err error, action string) {
+	reason := ErrorReason(err)
+	fields := log.Fields{"action": action, "reason": reason}
+	if infoErr, ok := err.(*ContainerInfoError); ok {
+		fields["container"] = infoErr.ID
+		err = infoErr.Err
+	}
+
+	entry := log.WithFields(fields)
+	switch reason {
+	case ReasonSkippedNoLabels:
+		entry.Debugf("container has no domain: %s", err.Error())
+	case ReasonSkippedNoNetwork:
+		entry.Debugf("container is not on a july network: %s", err.Error())
+	case ReasonNoIPYet:
+		entry.Infof("container has no ip yet: %s", err.Error())
+	default:
+		entry.Errorf("get container ip info failed. Error: %s", err.Error())
+	}
+}
+
+// retryStart queues the start event of a container which had no ip yet once
+// more, until MaxNoIPRetries
+func (listener *DockerListener) retryStart(e *docker.APIEvents) {
+	if listener.retries == nil {
+		return
+	}
+
+	attempt := 0
+	fmt.Sscanf(e.Actor.Attributes[RetryAttribute], "%d", &attempt)
+	if attempt >= MaxNoIPRetries {
+		log.WithFields(log.Fields{"container": e.ID, "attempts": attempt}).Warn("container still has no ip on a july network, give up")
+		return
+	}
+
+	retry := *e
+	retry.Actor.Attributes = make(map[string]string)
+	for key, value := range e.Actor.Attributes {
+		retry.Actor.Attributes[key] = value
+	}
+	retry.Actor.Attributes[RetryAttribute] = fmt.Sprintf("%d", attempt+1)
+
+	time.AfterFunc(time.Second<<uint(attempt), func() {
+		listener.retries <- &retry
+	})
+}
+
+func isRetry(e *docker.APIEvents) bool {
+	_, ok := e.Actor.Attributes[RetryAttribute]
+	return ok
+}
@@ -0,0 +1,85 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/upccup/july/webhook"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WebhookHandler posts the hook context as json to the endpoint, the
+// X-July-Event header is the docker event, e.g. container.start. It is
+// signed and retried like the july event webhooks.
+type WebhookHandler struct {
+	webhook.Endpoint
+}
+
+func (h *WebhookHandler) Handle(ctx *HookContext) error {
+	body, err := json.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+
+	return h.Send(ctx.Event.Type+"."+ctx.Event.Action, body)
+}
+
+// ExecHandler runs Command with the hook context as json on its stdin. The
+// main fields are also set in the environment: JULY_EVENT_TYPE,
+// JULY_EVENT_ACTION, JULY_CONTAINER_ID and, for july containers,
+// JULY_CONTAINER_IP and JULY_DOMAIN.
+type ExecHandler struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+func (h *ExecHandler) Handle(ctx *HookContext) error {
+	body, err := json.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(h.Command, h.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"JULY_EVENT_TYPE="+ctx.Event.Type,
+		"JULY_EVENT_ACTION="+ctx.Event.Action,
+		"JULY_CONTAINER_ID="+ctx.ContainerID(),
+	)
+	if ctx.Info != nil {
+		cmd.Env = append(cmd.Env,
+			"JULY_CONTAINER_IP="+ctx.Info.IP,
+			"JULY_DOMAIN="+ctx.Info.Domain+"."+ctx.Info.Zone,
+		)
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %s", err.Error(), output.String())
+		}
+		log.Debugf("hook command %s output: %s", h.Command, output.String())
+		return nil
+	case <-time.After(h.Timeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("command %s timed out after %s", h.Command, h.Timeout)
+	}
+}
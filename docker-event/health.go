@@ -0,0 +1,165 @@
+package event
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+	"github.com/upccup/july/webhook"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+)
+
+const DefaultHealthGracePeriod = 30 * time.Second
+
+// healthTimers holds the pending withdrawals of unhealthy containers
+type healthTimers struct {
+	sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func (h *healthTimers) start(ID string, d time.Duration, f func()) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.timers == nil {
+		h.timers = make(map[string]*time.Timer)
+	}
+
+	// keep the first timer, the grace period starts with the first unhealthy
+	if _, ok := h.timers[ID]; ok {
+		return
+	}
+
+	h.timers[ID] = time.AfterFunc(d, func() {
+		h.Lock()
+		delete(h.timers, ID)
+		h.Unlock()
+		f()
+	})
+}
+
+func (h *healthTimers) cancel(ID string) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	timer, ok := h.timers[ID]
+	if !ok {
+		return false
+	}
+
+	timer.Stop()
+	delete(h.timers, ID)
+	return true
+}
+
+func (listener *DockerListener) handleHealthy(ID string) {
+	if listener.health.cancel(ID) {
+		log.Infof("container %s recovered within the grace period, keep its records", ID)
+	}
+
+	ipInfo, err := loadContainerIPInfo(ID)
+	if err != nil || !ipInfo.HealthCheck || !ipInfo.Withdrawn {
+		return
+	}
+
+	if err := listener.addRecords(ipInfo); err != nil {
+		return
+	}
+
+	ipInfo.Withdrawn = false
+	storeContainerIPInfo(ID, ipInfo)
+	notifyDomain(webhook.EventDomainBound, ipInfo)
+}
+
+func (listener *DockerListener) handleUnhealthy(ID string) {
+	ipInfo, err := loadContainerIPInfo(ID)
+	if err != nil || !ipInfo.HealthCheck || ipInfo.Withdrawn {
+		return
+	}
+
+	grace := listener.HealthGracePeriod
+	if grace <= 0 {
+		grace = DefaultHealthGracePeriod
+	}
+
+	log.Infof("container %s is unhealthy, withdraw its records in %s", ID, grace)
+	listener.health.start(ID, grace, func() {
+		listener.withdrawUnhealthy(ID)
+	})
+}
+
+func (listener *DockerListener) withdrawUnhealthy(ID string) {
+	containerInfo, err := listener.DockerClient.InspectContainer(ID)
+	if err != nil {
+		log.Errorf("inspect unhealthy container %s failed. Error: %s", ID, err.Error())
+		return
+	}
+
+	if !containerInfo.State.Running || containerInfo.State.Health.Status != "unhealthy" {
+		return
+	}
+
+	ipInfo, err := loadContainerIPInfo(ID)
+	if err != nil || ipInfo.Withdrawn {
+		return
+	}
+
+	log.Infof("container %s is still unhealthy, withdraw its records", ID)
+	if err := listener.deleteRecords(ipInfo); err != nil {
+		return
+	}
+
+	ipInfo.Withdrawn = true
+	storeContainerIPInfo(ID, ipInfo)
+	notifyDomain(webhook.EventDomainUnbound, ipInfo)
+}
+
+// hasStoredDomain tells whether a container has a stored domain, most
+// containers have none
+func hasStoredDomain(ID string) (bool, error) {
+	_, err := db.GetKey(filepath.Join(config.ContainerDomainsStorePath, ID))
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func loadContainerIPInfo(ID string) (*ContainerIPInfo, error) {
+	domainBytes, err := db.GetKey(filepath.Join(config.ContainerDomainsStorePath, ID))
+	if err != nil {
+		log.Errorf("get container %s domain failed. Error: %s", ID, err.Error())
+		return nil, err
+	}
+
+	var ipInfo ContainerIPInfo
+	if err := json.Unmarshal([]byte(domainBytes), &ipInfo); err != nil {
+		log.Errorf("Unmarshal %s failed. Error: %s", domainBytes, err.Error())
+		return nil, err
+	}
+
+	return &ipInfo, nil
+}
+
+func storeContainerIPInfo(ID string, ipInfo *ContainerIPInfo) error {
+	ipInfoBytes, err := json.Marshal(ipInfo)
+	if err != nil {
+		log.Errorf("Marshal ContainerIPInfo: %+v failed. Err: %s", ipInfo, err.Error())
+		return err
+	}
+
+	if err := db.SetKey(filepath.Join(config.ContainerDomainsStorePath, ID), string(ipInfoBytes)); err != nil {
+		log.Errorf("store container %s domain %s failed. Error: %s", ID, string(ipInfoBytes), err.Error())
+		return err
+	}
+
+	return nil
+}
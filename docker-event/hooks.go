@@ -0,0 +1,239 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	docker "github.com/upccup/july/docker-client"
+	"github.com/upccup/july/webhook"
+)
+
+const (
+	HookTypeWebhook = "webhook"
+	HookTypeExec    = "exec"
+
+	DefaultHookTimeout = 10 * time.Second
+)
+
+// HookContext is what a hook gets for an event. Info is the july view of the
+// container, it is nil for containers without JR_DOMAIN_* labels.
+type HookContext struct {
+	Event *docker.APIEvents
+	Info  *ContainerIPInfo `json:",omitempty"`
+}
+
+// ContainerID is the container the event is about
+func (ctx *HookContext) ContainerID() string {
+	if ctx.Event.Type == EventTypeNetwork {
+		return ctx.Event.Actor.Attributes["container"]
+	}
+
+	return ctx.Event.ID
+}
+
+// Handler acts on the events matched by its hook
+type Handler interface {
+	Handle(ctx *HookContext) error
+}
+
+type HandlerFunc func(ctx *HookContext) error
+
+func (f HandlerFunc) Handle(ctx *HookContext) error {
+	return f(ctx)
+}
+
+// Matcher selects events. Empty fields match everything, Labels match the
+// container labels docker sends in the event attributes, an empty value only
+// requires the label to be set.
+type Matcher struct {
+	Types   []string          `json:"types,omitempty"`
+	Actions []string          `json:"actions,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+func (m Matcher) Matches(ctx *HookContext) bool {
+	if len(m.Types) > 0 && !contains(m.Types, ctx.Event.Type) {
+		return false
+	}
+
+	if len(m.Actions) > 0 && !contains(m.Actions, ctx.Event.Action) {
+		return false
+	}
+
+	for key, value := range m.Labels {
+		label, ok := ctx.Event.Actor.Attributes[key]
+		if !ok && ctx.Info != nil {
+			label, ok = ctx.Info.Labels[key]
+		}
+
+		if !ok || (value != "" && label != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Hook struct {
+	Name    string
+	Match   Matcher
+	Handler Handler
+}
+
+// hooks returns the built-in dns hook followed by the configured ones
+func (listener *DockerListener) hooks() []Hook {
+	dnsHook := Hook{
+		Name:  "dns",
+		Match: Matcher{Types: []string{EventTypeContainer, EventTypeNetwork, EventTypeService}},
+		Handler: HandlerFunc(func(ctx *HookContext) error {
+			listener.handleDNSEvent(ctx)
+			return nil
+		}),
+	}
+
+	return append([]Hook{dnsHook}, listener.Hooks...)
+}
+
+// HookConfig is one hook of the hooks file, e.g.
+//
+//	{"name": "lb", "type": "webhook", "url": "http://lb/containers",
+//	 "match": {"actions": ["start", "die"], "labels": {"lb.enable": "true"}}}
+//
+// A webhook with events gets the july events instead of the docker ones:
+//
+//	{"name": "audit", "type": "webhook", "url": "http://audit/july",
+//	 "secret": "s3cret", "events": ["ip.allocated", "domain.bound"]}
+type HookConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Match   Matcher           `json:"match"`
+	Events  []string          `json:"events,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Secret  string            `json:"secret,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Retries int               `json:"retries,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+}
+
+type HooksFile struct {
+	Hooks []HookConfig `json:"hooks"`
+}
+
+// LoadHooksFile reads a json hooks file
+func LoadHooksFile(file string) (*HooksFile, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var hooksFile HooksFile
+	if err := json.Unmarshal(content, &hooksFile); err != nil {
+		return nil, fmt.Errorf("parse hooks file %s failed: %s", file, err.Error())
+	}
+
+	return &hooksFile, nil
+}
+
+// DockerHooks builds the hooks run on the docker events they match
+func (f *HooksFile) DockerHooks() ([]Hook, error) {
+	var hooks []Hook
+	for _, hookConfig := range f.Hooks {
+		if len(hookConfig.Events) > 0 {
+			continue
+		}
+
+		handler, err := NewHandler(hookConfig)
+		if err != nil {
+			return nil, fmt.Errorf("hook %s: %s", hookConfig.Name, err.Error())
+		}
+
+		hooks = append(hooks, Hook{Name: hookConfig.Name, Match: hookConfig.Match, Handler: handler})
+	}
+
+	return hooks, nil
+}
+
+// Webhooks returns the webhooks notified of the july events
+func (f *HooksFile) Webhooks() ([]webhook.Config, error) {
+	var configs []webhook.Config
+	for _, hookConfig := range f.Hooks {
+		if len(hookConfig.Events) == 0 {
+			continue
+		}
+
+		if hookConfig.Type != HookTypeWebhook || hookConfig.URL == "" {
+			return nil, fmt.Errorf("hook %s: only webhooks with an url get july events", hookConfig.Name)
+		}
+
+		timeout, err := hookTimeout(hookConfig)
+		if err != nil {
+			return nil, fmt.Errorf("hook %s: %s", hookConfig.Name, err.Error())
+		}
+
+		configs = append(configs, webhook.Config{
+			URL:     hookConfig.URL,
+			Secret:  hookConfig.Secret,
+			Headers: hookConfig.Headers,
+			Events:  hookConfig.Events,
+			Retries: hookConfig.Retries,
+			Timeout: timeout,
+		})
+	}
+
+	return configs, nil
+}
+
+func NewHandler(hookConfig HookConfig) (Handler, error) {
+	timeout, err := hookTimeout(hookConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	switch hookConfig.Type {
+	case HookTypeWebhook:
+		if hookConfig.URL == "" {
+			return nil, fmt.Errorf("webhook needs an url")
+		}
+		return &WebhookHandler{Endpoint: webhook.Endpoint{
+			URL:     hookConfig.URL,
+			Secret:  hookConfig.Secret,
+			Headers: hookConfig.Headers,
+			Retries: hookConfig.Retries,
+			Timeout: timeout,
+		}}, nil
+	case HookTypeExec:
+		if hookConfig.Command == "" {
+			return nil, fmt.Errorf("exec needs a command")
+		}
+		return &ExecHandler{Command: hookConfig.Command, Args: hookConfig.Args, Timeout: timeout}, nil
+	}
+
+	return nil, fmt.Errorf("unknown hook type %s", hookConfig.Type)
+}
+
+func hookTimeout(hookConfig HookConfig) (time.Duration, error) {
+	if hookConfig.Timeout == "" {
+		return DefaultHookTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(hookConfig.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %s", hookConfig.Timeout)
+	}
+
+	return timeout, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
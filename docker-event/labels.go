@@ -0,0 +1,176 @@
+package event
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"text/template"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LabelKeys are the labels a container or service sets its domain with
+type LabelKeys struct {
+	Zone        string
+	Name        string
+	Names       string
+	Aliases     string
+	Ports       string
+	TTL         string
+	Weight      string
+	Priority    string
+	HealthCheck string
+}
+
+var DefaultLabelKeys = LabelKeys{
+	Zone:        DomainZoneKey,
+	Name:        DomainNameKey,
+	Names:       DomainNamesKey,
+	Aliases:     DomainAliasesKey,
+	Ports:       DomainPortsKey,
+	TTL:         DomainTTLKey,
+	Weight:      DomainWeightKey,
+	Priority:    DomainPriorityKey,
+	HealthCheck: DomainHealthCheckKey,
+}
+
+// NamespacedLabelKeys returns the label keys under a namespace, e.g.
+// com.example.dns gives com.example.dns.zone, com.example.dns.name, ...
+func NamespacedLabelKeys(namespace string) LabelKeys {
+	prefix := strings.TrimSuffix(namespace, ".") + "."
+	return LabelKeys{
+		Zone:        prefix + "zone",
+		Name:        prefix + "name",
+		Names:       prefix + "names",
+		Aliases:     prefix + "aliases",
+		Ports:       prefix + "ports",
+		TTL:         prefix + "ttl",
+		Weight:      prefix + "weight",
+		Priority:    prefix + "priority",
+		HealthCheck: prefix + "healthcheck",
+	}
+}
+
+// NameData is what name templates are rendered with, e.g.
+// {{.Name}}.{{.Labels.team}}
+type NameData struct {
+	ID       string
+	Name     string
+	Image    string
+	Hostname string
+	Labels   map[string]string
+}
+
+// ParseNameTemplate checks a name template
+func ParseNameTemplate(text string) (*template.Template, error) {
+	return template.New("name").Option("missingkey=zero").Parse(text)
+}
+
+func (listener *DockerListener) labelKeys() LabelKeys {
+	if listener.LabelKeys.Zone == "" {
+		return DefaultLabelKeys
+	}
+
+	return listener.LabelKeys
+}
+
+// domainInfo reads the domain of a container or service from its labels. The
+// zone falls back to DefaultZone and the name to NameTemplate, then to the
+// container name. Names and aliases may be templates too.
+func (listener *DockerListener) domainInfo(labels map[string]string, data NameData) (*ContainerIPInfo, error) {
+	keys := listener.labelKeys()
+	zone := labels[keys.Zone]
+	if zone == "" {
+		zone = listener.DefaultZone
+	}
+
+	if zone == "" {
+		return nil, errors.New("no domain zone: neither a zone label nor a default zone")
+	}
+
+	names := keys.domainNames(labels, zone)
+	if len(names) == 0 {
+		name := listener.NameTemplate
+		if name == "" {
+			name = data.Name
+		}
+		names = []DomainName{{Name: name, Zone: zone}}
+	}
+
+	names = renderNames(names, data)
+	if len(names) == 0 {
+		return nil, errors.New("no domain name: the name template rendered empty")
+	}
+
+	info := &ContainerIPInfo{
+		Name:     data.Name,
+		Labels:   labels,
+		Domain:   names[0].Name,
+		Zone:     names[0].Zone,
+		Names:    names,
+		Aliases:  renderNames(splitNames(labels[keys.Aliases], zone), data),
+		TTL:      uint32(intLabel(labels, keys.TTL)),
+		Weight:   intLabel(labels, keys.Weight),
+		Priority: intLabel(labels, keys.Priority),
+	}
+
+	if healthCheck, err := strconv.ParseBool(labels[keys.HealthCheck]); err == nil {
+		info.HealthCheck = healthCheck
+	}
+
+	if portsLabel, ok := labels[keys.Ports]; ok {
+		ports, err := parsePorts(portsLabel)
+		if err != nil {
+			log.Warnf("%s has invalid %s label. Error: %s", data.Name, keys.Ports, err.Error())
+		} else {
+			info.Ports = ports
+		}
+	}
+
+	return info, nil
+}
+
+// renderNames executes the names which are templates, the ones failing or
+// rendering empty are dropped
+func renderNames(names []DomainName, data NameData) []DomainName {
+	var rendered []DomainName
+	for _, name := range names {
+		if strings.Contains(name.Name, "{{") {
+			text, err := renderName(name.Name, data)
+			if err != nil {
+				log.Warnf("render name %s of %s failed. Error: %s", name.Name, data.Name, err.Error())
+				continue
+			}
+			name.Name = text
+		}
+
+		if name.Name != "" {
+			rendered = append(rendered, name)
+		}
+	}
+
+	return uniqueNames(rendered)
+}
+
+func renderName(text string, data NameData) (string, error) {
+	tmpl, err := ParseNameTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	// a missing label leaves an empty label in the name, e.g. "web..zone"
+	var labels []string
+	for _, label := range strings.Split(buf.String(), ".") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+
+	return strings.ToLower(strings.Join(labels, ".")), nil
+}
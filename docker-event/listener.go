@@ -1,46 +1,326 @@
 package event
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/upccup/july/config"
 	"github.com/upccup/july/db"
 	dns "github.com/upccup/july/dns-handler"
 	docker "github.com/upccup/july/docker-client"
+	"github.com/upccup/july/ipamdriver"
+	"github.com/upccup/july/webhook"
 
 	log "github.com/Sirupsen/logrus"
 )
 
 const (
 	EventTypeContainer = "container"
+	EventTypeNetwork   = "network"
 
 	EventContainerCreate  = "create"
 	EventContainerStart   = "start"
 	EventContainerKill    = "kill"
 	EventContainerDie     = "die"
-	EventContainerDestory = "destory"
+	EventContainerDestroy = "destroy"
+	EventContainerRename  = "rename"
 
-	DomainZoneKey = "JR_DOMAIN_ZONE"
-	DomainNameKey = "JR_DOMAIN_NAME"
+	EventNetworkConnect    = "connect"
+	EventNetworkDisconnect = "disconnect"
+
+	EventContainerHealthy   = "health_status: healthy"
+	EventContainerUnhealthy = "health_status: unhealthy"
+
+	DomainZoneKey     = "JR_DOMAIN_ZONE"
+	DomainNameKey     = "JR_DOMAIN_NAME"
+	DomainNamesKey    = "JR_DOMAIN_NAMES"
+	DomainAliasesKey  = "JR_DOMAIN_ALIASES"
+	DomainPortsKey    = "JR_DOMAIN_PORTS"
+	DomainTTLKey      = "JR_DOMAIN_TTL"
+	DomainWeightKey   = "JR_DOMAIN_WEIGHT"
+	DomainPriorityKey = "JR_DOMAIN_PRIORITY"
+
+	// DomainHealthCheckKey opts a container into health aware publishing,
+	// its records are only published while docker reports it healthy
+	DomainHealthCheckKey = "JR_DOMAIN_HEALTHCHECK"
 )
 
 type DockerListener struct {
 	DockerClient *docker.Client
-	DNSClient    *dns.DNSClient
+	DNSProvider  dns.Provider
+
+	// EnablePTR also publishes the reverse record of every container address
+	EnablePTR bool
+
+	// NetworkName is the docker network whose IPs are published. When empty
+	// every network using the july IPAM or network driver is.
+	NetworkName string
+
+	// HealthGracePeriod is how long a container with JR_DOMAIN_HEALTHCHECK
+	// may stay unhealthy before its records are withdrawn
+	HealthGracePeriod time.Duration
+
+	// ReconcileInterval is how often the records are reconciled with the
+	// running containers, zero only reconciles at startup
+	ReconcileInterval time.Duration
+
+	// HostID is the docker daemon ID, it tells which stored domains belong
+	// to the containers of this host
+	HostID string
+
+	// ReplayWindow is how old the event checkpoint may be to resume from it,
+	// beyond it the records are reconciled instead
+	ReplayWindow time.Duration
+
+	// Workers handle the events concurrently, each with a queue of
+	// QueueSize events. QueuePolicy tells what to do when a queue is full.
+	Workers     int
+	QueueSize   int
+	QueuePolicy string
+
+	// Hooks run after the dns hook on every event they match
+	Hooks []Hook
+
+	// LabelKeys are the labels read for the domain, DefaultLabelKeys when
+	// unset. DefaultZone and NameTemplate publish containers without them.
+	LabelKeys    LabelKeys
+	DefaultZone  string
+	NameTemplate string
+
+	// EnableServices publishes the swarm services labeled JR_DOMAIN_ZONE,
+	// polling their tasks every ServiceSyncInterval
+	EnableServices      bool
+	ServiceSyncInterval time.Duration
+	serviceSync         chan struct{}
+	retries             chan *docker.APIEvents
+
+	resumedAt    int64
+	lastEvent    int64
+	recent       eventSet
+	tracker      eventTracker
+	health       healthTimers
+	networksLock sync.Mutex
+	julyNetworks map[string]bool
 }
 
 type ContainerIPInfo struct {
+	// ID owns the records of the container, infos stored before ownership
+	// was tracked have none
+	ID     string `json:",omitempty"`
+	Host   string `json:",omitempty"`
+	Name   string `json:",omitempty"`
 	IP     string
 	Domain string
 	Zone   string
 	Labels map[string]string
+	Ports  []PortInfo `json:",omitempty"`
+
+	// Names are all the names with an address record, the first one is the
+	// canonical Domain/Zone. Aliases are CNAMEs of the canonical name.
+	Names   []DomainName `json:",omitempty"`
+	Aliases []DomainName `json:",omitempty"`
+
+	// TTL, Weight and Priority come from the JR_DOMAIN_TTL/WEIGHT/PRIORITY
+	// labels, zero means the backend default
+	TTL      uint32 `json:",omitempty"`
+	Weight   int    `json:",omitempty"`
+	Priority int    `json:",omitempty"`
+
+	// ReverseZone is derived from the subnet of the container pool, it is
+	// empty when no PTR record is published
+	ReverseZone string `json:",omitempty"`
+
+	// Networks are the addresses of the container on every july network, IP
+	// and ReverseZone are the ones of the first
+	Networks []NetworkIP `json:",omitempty"`
+
+	// HealthCheck is set by the JR_DOMAIN_HEALTHCHECK label. Withdrawn means
+	// the records are not in DNS, waiting for the container to be healthy.
+	HealthCheck bool `json:",omitempty"`
+	Withdrawn   bool `json:",omitempty"`
+}
+
+type NetworkIP struct {
+	Network     string
+	IP          string
+	ReverseZone string `json:",omitempty"`
+}
+
+type DomainName struct {
+	Name string
+	Zone string
+}
+
+func (n DomainName) FQDN() string {
+	return n.Name + "." + n.Zone
+}
+
+// PortInfo is a service port of the container, published as the SRV record
+// _<Name>._<Proto>.<Domain>.<Zone>
+type PortInfo struct {
+	Name  string
+	Port  int
+	Proto string
+}
+
+// AllNames returns every name with an address record. Infos stored before
+// multiple names were supported only carry Domain and Zone.
+func (info *ContainerIPInfo) AllNames() []DomainName {
+	if len(info.Names) == 0 {
+		return []DomainName{{Name: info.Domain, Zone: info.Zone}}
+	}
+
+	return info.Names
+}
+
+// Addresses returns the container address on every july network. Infos
+// stored before multiple networks were supported only carry IP.
+func (info *ContainerIPInfo) Addresses() []NetworkIP {
+	if len(info.Networks) == 0 {
+		return []NetworkIP{{IP: info.IP, ReverseZone: info.ReverseZone}}
+	}
+
+	return info.Networks
+}
+
+// AddressRecord is the A or AAAA record of the canonical container domain
+func (info *ContainerIPInfo) AddressRecord() dns.Record {
+	return info.addressRecord(DomainName{Name: info.Domain, Zone: info.Zone}, info.IP)
+}
+
+func (info *ContainerIPInfo) addressRecord(name DomainName, ip string) dns.Record {
+	return dns.Record{
+		Name:  name.Name,
+		Zone:  name.Zone,
+		Type:  dns.AddressRecordType(ip),
+		Value: ip,
+		TTL:   info.TTL,
+		Owner: info.ID,
+	}
+}
+
+// AliasRecords are the CNAME records of the aliases
+func (info *ContainerIPInfo) AliasRecords() []dns.Record {
+	var records []dns.Record
+	target := info.AddressRecord().FQDN()
+	for _, alias := range info.Aliases {
+		records = append(records, dns.Record{
+			Name:  alias.Name,
+			Zone:  alias.Zone,
+			Type:  dns.RecordTypeCNAME,
+			Value: target,
+			TTL:   info.TTL,
+			Owner: info.ID,
+		})
+	}
+
+	return records
+}
+
+// ServiceRecords are the SRV records of the container ports, all pointing at
+// the container domain
+func (info *ContainerIPInfo) ServiceRecords() []dns.Record {
+	var records []dns.Record
+	target := info.AddressRecord().FQDN()
+	for _, port := range info.Ports {
+		records = append(records, dns.Record{
+			Name:     "_" + port.Name + "._" + port.Proto + "." + info.Domain,
+			Zone:     info.Zone,
+			Type:     dns.RecordTypeSRV,
+			Value:    target,
+			Port:     port.Port,
+			Priority: info.Priority,
+			Weight:   info.Weight,
+			TTL:      info.TTL,
+			Owner:    info.ID,
+		})
+	}
+
+	return records
+}
+
+// Records returns every record published for the container
+func (info *ContainerIPInfo) Records() []dns.Record {
+	var records []dns.Record
+	for _, name := range info.AllNames() {
+		for _, address := range info.Addresses() {
+			records = append(records, info.addressRecord(name, address.IP))
+		}
+	}
+
+	records = append(records, info.ServiceRecords()...)
+	records = append(records, info.AliasRecords()...)
+
+	target := info.AddressRecord().FQDN()
+	for _, address := range info.Addresses() {
+		if address.ReverseZone == "" {
+			continue
+		}
+
+		ptrRecord, err := dns.PTRRecord(address.IP, address.ReverseZone, target)
+		if err != nil {
+			log.Warnf("build ptr record of %s failed. Error: %s", address.IP, err.Error())
+			continue
+		}
+
+		ptrRecord.TTL = info.TTL
+		ptrRecord.Owner = info.ID
+		records = append(records, ptrRecord)
+	}
+
+	return records
+}
+
+func (listener *DockerListener) addRecords(info *ContainerIPInfo) error {
+	var firstErr error
+	for _, record := range info.Records() {
+		if err := listener.DNSProvider.AddRecord(record); err != nil {
+			log.Errorf("add dns record %s failed. Error: %s", record, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func (listener *DockerListener) deleteRecords(info *ContainerIPInfo) error {
+	var firstErr error
+	for _, record := range info.Records() {
+		if err := listener.DNSProvider.DeleteRecord(record); err != nil {
+			log.Errorf("delete dns record %s failed. Error: %s", record, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
 }
 
 func (listener *DockerListener) StartListenDockerAction() {
+	if listener.HostID == "" {
+		dockerInfo, err := listener.DockerClient.Info()
+		if err != nil {
+			log.Fatalf("get docker info got error: %+v", err)
+		}
+		listener.HostID = dockerInfo.ID
+	}
+
+	since, resumed := listener.resumePoint()
 	eventsChan := make(chan *docker.APIEvents, 10)
-	if err := listener.DockerClient.AddEventListener(eventsChan); err != nil {
+	if err := listener.DockerClient.AddEventListenerSince(eventsChan, since); err != nil {
 		log.Fatalf("create docker client got error: %+v", err)
 	}
 
@@ -52,19 +332,98 @@ func (listener *DockerListener) StartListenDockerAction() {
 		}
 	}()
 
+	// without a recent checkpoint events were lost, reconcile once the events
+	// are listened to, so nothing falls in between
+	if resumed {
+		log.Infof("resume docker events since %s", time.Unix(since, 0).Format(time.RFC3339))
+	} else if err := listener.Reconcile(); err != nil {
+		log.Errorf("reconcile dns records failed. Error: %s", err.Error())
+	}
+
+	var reconcileChan <-chan time.Time
+	if listener.ReconcileInterval > 0 {
+		ticker := time.NewTicker(listener.ReconcileInterval)
+		defer ticker.Stop()
+		reconcileChan = ticker.C
+	}
+
+	if listener.EnableServices {
+		listener.serviceSync = make(chan struct{}, 1)
+		go listener.syncServicesLoop()
+	}
+
+	listener.retries = make(chan *docker.APIEvents, 10)
+	pool := newEventPool(listener)
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGINT)
+
 	for {
 		select {
-		case e := <-eventsChan:
-			if e != nil {
-				listener.HandleDockerEvent(e)
+		case e, ok := <-eventsChan:
+			if !ok {
+				// the client closes the listeners when the event stream is
+				// lost, listen again from the last dispatched event
+				log.Warn("docker event stream closed, listen again")
+				time.Sleep(time.Second)
+				eventsChan = make(chan *docker.APIEvents, 10)
+				if err := listener.DockerClient.AddEventListenerSince(eventsChan, listener.resubscribePoint()); err != nil {
+					log.Fatalf("create docker client got error: %+v", err)
+				}
+				continue
+			}
+
+			if e == nil || listener.replayed(e) {
+				continue
+			}
+
+			if eventTime(e) > listener.lastEvent {
+				listener.lastEvent = eventTime(e)
 			}
+			pool.dispatch(e)
+		case e := <-listener.retries:
+			pool.dispatch(e)
+		case <-reconcileChan:
+			// reconcile alone, so it doesn't race the events of a container
+			pool.wait()
+			if err := listener.Reconcile(); err != nil {
+				log.Errorf("reconcile dns records failed. Error: %s", err.Error())
+			}
+		case sig := <-signalChan:
+			log.Infof("got signal %s, handle the queued events and exit", sig)
+			pool.stop()
+			return
 		}
 	}
 }
 
+// HandleDockerEvent runs every hook matching the event, the dns hook first
+// so that the others get the container info it collected. Retried start
+// events only run the dns hook.
 func (listener *DockerListener) HandleDockerEvent(e *docker.APIEvents) {
-	if e.Type != EventTypeContainer {
-		log.Debugf("got event from docker: %#v, type is not container drop it!!!", e)
+	ctx := &HookContext{Event: e}
+	for i, hook := range listener.hooks() {
+		if !hook.Match.Matches(ctx) || (i > 0 && isRetry(e)) {
+			continue
+		}
+
+		if err := hook.Handler.Handle(ctx); err != nil {
+			log.Errorf("hook %s failed on %s event of %s. Error: %s", hook.Name, e.Action, e.ID, err.Error())
+		}
+	}
+}
+
+// handleDNSEvent keeps the records of a container in line with its events,
+// it fills the container info of ctx for the hooks after it
+func (listener *DockerListener) handleDNSEvent(ctx *HookContext) {
+	e := ctx.Event
+	if e.Type == EventTypeService {
+		log.Infof("got service %s event, service ID: %s", e.Action, e.Actor.ID)
+		listener.triggerServiceSync()
+		return
+	}
+
+	if e.Type == EventTypeNetwork {
+		ctx.Info = listener.handleNetworkEvent(e)
 		return
 	}
 
@@ -73,86 +432,357 @@ func (listener *DockerListener) HandleDockerEvent(e *docker.APIEvents) {
 		log.Infof("got container start event, container ID: %s", e.ID)
 		containerIPInfo, err := listener.GetContainerIPInfo(e.ID)
 		if err != nil {
-			log.Errorf("get container ip info failed. Error: %s", err.Error())
+			logContainerInfoError(err, e.Action)
+			if ErrorReason(err) == ReasonNoIPYet {
+				listener.retryStart(e)
+			}
 			return
 		}
 
-		ipInfoBytes, err := json.Marshal(containerIPInfo)
-		if err != nil {
-			log.Errorf("Marshal ContainerIPInfo: %+v failed. Err: %s", containerIPInfo, err.Error())
+		// health checked containers are published by their first healthy event
+		ctx.Info = containerIPInfo
+		containerIPInfo.Withdrawn = containerIPInfo.HealthCheck
+		if err := storeContainerIPInfo(e.ID, containerIPInfo); err != nil {
 			return
 		}
 
-		if err := db.SetKey(filepath.Join(config.ContainerDomainsStorePath, e.ID), string(ipInfoBytes)); err != nil {
-			log.Errorf("store container %s domain %s failed. Error: %s", e.ID, string(ipInfoBytes), err.Error())
+		if containerIPInfo.Withdrawn {
+			log.Infof("container %s waits to be healthy before publishing its records", e.ID)
 			return
 		}
 
-		if err := listener.DNSClient.AddDNSRecord(containerIPInfo.Zone, containerIPInfo.Domain, containerIPInfo.IP); err != nil {
-			log.Errorf("add dns record failed. Error: %s", err.Error())
+		if err := listener.addRecords(containerIPInfo); err != nil {
 			return
 		}
-	case EventContainerDie:
-		log.Infof("got container died event, container ID: %s", e.ID)
-		domainStoreKey := filepath.Join(config.ContainerDomainsStorePath, e.ID)
-		domainBytes, err := db.GetKey(domainStoreKey)
+		notifyDomain(webhook.EventDomainBound, containerIPInfo)
+	case EventContainerHealthy, EventContainerUnhealthy:
+		stored, err := hasStoredDomain(e.ID)
 		if err != nil {
 			log.Errorf("get container %s domain failed. Error: %s", e.ID, err.Error())
 			return
 		}
 
-		var ipInfo ContainerIPInfo
-		if err := json.Unmarshal([]byte(domainBytes), &ipInfo); err != nil {
-			log.Errorf("Unmarshal %s failed. Error: %s", string(domainBytes), err.Error())
-			return
-		}
-
-		if err := listener.DNSClient.DeleteDNSRecord(ipInfo.Domain); err != nil {
-			log.Errorf("delete dns record %s.%s failed. Error: %s", ipInfo.Zone, ipInfo.Domain, err.Error())
+		if !stored {
 			return
 		}
 
-		if err := db.DeleteKey(domainStoreKey); err != nil {
-			log.Errorf("delete container %s dns from db failed. Error: %s", domainStoreKey, err.Error())
-			return
+		if e.Action == EventContainerUnhealthy {
+			log.Infof("got container unhealthy event, container ID: %s", e.ID)
+			listener.handleUnhealthy(e.ID)
+		} else {
+			log.Infof("got container healthy event, container ID: %s", e.ID)
+			listener.handleHealthy(e.ID)
 		}
+		ctx.Info, _ = loadContainerIPInfo(e.ID)
+	case EventContainerDie:
+		log.Infof("got container died event, container ID: %s", e.ID)
+		ctx.Info = listener.removeContainer(e.ID)
+	case EventContainerDestroy:
+		// die already removed the domain, unless it was missed
+		log.Infof("got container destroy event, container ID: %s", e.ID)
+		ctx.Info = listener.removeContainer(e.ID)
+	case EventContainerRename:
+		log.Infof("got container rename event, container ID: %s, new name: %s", e.ID, e.Actor.Attributes["name"])
+		ctx.Info = listener.resyncContainer(e.ID)
 	default:
 		log.Debugf("got event from docker: %#v, not be interested in it drop!!", e)
 		return
 	}
 }
 
+// handleNetworkEvent publishes or removes the address of a container when it
+// is connected to or disconnected from a july network
+func (listener *DockerListener) handleNetworkEvent(e *docker.APIEvents) *ContainerIPInfo {
+	if e.Action != EventNetworkConnect && e.Action != EventNetworkDisconnect {
+		log.Debugf("got network event from docker: %#v, not be interested in it drop!!", e)
+		return nil
+	}
+
+	containerID := e.Actor.Attributes["container"]
+	if containerID == "" || !listener.isJulyNetwork(e.Actor.Attributes["name"], e.Actor.ID) {
+		return nil
+	}
+
+	log.Infof("got network %s event, network: %s, container ID: %s", e.Action, e.Actor.Attributes["name"], containerID)
+	return listener.resyncContainer(containerID)
+}
+
+// resyncContainer publishes the changes of a running container
+func (listener *DockerListener) resyncContainer(ID string) *ContainerIPInfo {
+	containerInfo, err := listener.DockerClient.InspectContainer(ID)
+	if err != nil {
+		log.Errorf("inspect container %s failed. Error: %s", ID, err.Error())
+		return nil
+	}
+
+	if !containerInfo.State.Running {
+		return nil
+	}
+
+	hasDomain, err := hasStoredDomain(ID)
+	if err != nil {
+		log.Errorf("get container %s domain failed. Error: %s", ID, err.Error())
+		return nil
+	}
+
+	var stored *ContainerIPInfo
+	if hasDomain {
+		if stored, err = loadContainerIPInfo(ID); err != nil {
+			return nil
+		}
+	}
+
+	info, err := listener.syncContainer(ID, stored, "")
+	if err != nil {
+		log.Errorf("sync container %s failed. Error: %s", ID, err.Error())
+	}
+
+	return info
+}
+
+// removeContainer deletes the records and the stored domain of a container,
+// it returns the removed info
+func (listener *DockerListener) removeContainer(ID string) *ContainerIPInfo {
+	listener.health.cancel(ID)
+
+	// most containers have no domain, don't log their missing key
+	hasDomain, err := hasStoredDomain(ID)
+	if err != nil {
+		log.Errorf("get container %s domain failed. Error: %s", ID, err.Error())
+		return nil
+	}
+
+	if !hasDomain {
+		log.WithFields(log.Fields{"container": ID}).Debug("container has no stored domain")
+		return nil
+	}
+
+	ipInfo, err := loadContainerIPInfo(ID)
+	if err != nil {
+		return nil
+	}
+
+	// the records are retried by the outbox, a failure must not leave the
+	// domain of a dead container in the store
+	if !ipInfo.Withdrawn {
+		listener.deleteRecords(ipInfo)
+		notifyDomain(webhook.EventDomainUnbound, ipInfo)
+	}
+
+	domainStoreKey := filepath.Join(config.ContainerDomainsStorePath, ID)
+	if err := db.DeleteKey(domainStoreKey); err != nil {
+		log.Errorf("delete container %s dns from db failed. Error: %s", domainStoreKey, err.Error())
+	}
+
+	return ipInfo
+}
+
+func notifyDomain(event string, info *ContainerIPInfo) {
+	var names []string
+	for _, name := range info.AllNames() {
+		names = append(names, name.FQDN())
+	}
+
+	webhook.Notify(event, webhook.DomainData{
+		ContainerID: info.ID,
+		IP:          info.IP,
+		Domain:      info.Domain,
+		Zone:        info.Zone,
+		Names:       names,
+	})
+}
+
 func (listener *DockerListener) GetContainerIPInfo(ID string) (*ContainerIPInfo, error) {
 	containerInfo, err := listener.DockerClient.InspectContainer(ID)
 	if err != nil {
-		return nil, err
+		return nil, containerInfoError(ReasonInspectFailed, ID, err)
 	}
 
-	if containerInfo == nil || containerInfo.Config.Labels == nil ||
-		containerInfo.NetworkSettings == nil || containerInfo.NetworkSettings.Networks == nil {
-		return nil, errors.New("get container IP info failed: null response")
+	if containerInfo == nil || containerInfo.Config == nil || containerInfo.NetworkSettings == nil {
+		return nil, containerInfoError(ReasonInspectFailed, ID, errors.New("null response"))
 	}
 
-	containerLabels := containerInfo.Config.Labels
+	ipInfo, err := listener.domainInfo(containerInfo.Config.Labels, NameData{
+		ID:       ID,
+		Name:     strings.TrimPrefix(containerInfo.Name, "/"),
+		Image:    containerInfo.Config.Image,
+		Hostname: containerInfo.Config.Hostname,
+		Labels:   containerInfo.Config.Labels,
+	})
+	if err != nil {
+		return nil, containerInfoError(ReasonSkippedNoLabels, ID, err)
+	}
 
-	domainMain, ok := containerLabels[DomainZoneKey]
-	if !ok {
-		return nil, errors.New("get container domain main info failed: null response")
+	networks := containerInfo.NetworkSettings.Networks
+	addresses := listener.julyAddresses(networks)
+	if len(addresses) == 0 {
+		if listener.onJulyNetwork(networks) {
+			return nil, containerInfoError(ReasonNoIPYet, ID, errors.New("no ip on a july network"))
+		}
+		return nil, containerInfoError(ReasonSkippedNoNetwork, ID, errors.New("not attached to a july network"))
+	}
+
+	containerInfoResults.Add("ok", 1)
+
+	ipInfo.ID = ID
+	ipInfo.Host = listener.HostID
+	ipInfo.IP = addresses[0].IP
+	if ipInfo.Ports == nil {
+		ipInfo.Ports = exposedPorts(containerInfo.Config.ExposedPorts)
+	}
+
+	if listener.EnablePTR {
+		for i := range addresses {
+			addresses[i].ReverseZone = reverseZone(addresses[i].IP)
+		}
+		ipInfo.ReverseZone = addresses[0].ReverseZone
+	}
+	ipInfo.Networks = addresses
+
+	return ipInfo, nil
+}
+
+// domainNames collects the names of a container in order: JR_DOMAIN_NAME,
+// the comma separated JR_DOMAIN_NAMES and the indexed JR_DOMAIN_NAME.<N>
+// labels, which may set their own zone with JR_DOMAIN_ZONE.<N>
+func (keys LabelKeys) domainNames(labels map[string]string, zone string) []DomainName {
+	var names []DomainName
+	if name, ok := labels[keys.Name]; ok && name != "" {
+		names = append(names, DomainName{Name: name, Zone: zone})
+	}
+
+	names = append(names, splitNames(labels[keys.Names], zone)...)
+
+	var indexes []int
+	for key := range labels {
+		if !strings.HasPrefix(key, keys.Name+".") {
+			continue
+		}
+
+		index, err := strconv.Atoi(strings.TrimPrefix(key, keys.Name+"."))
+		if err != nil {
+			log.Warnf("ignore label %s: the suffix is not a number", key)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		suffix := "." + strconv.Itoa(index)
+		name := DomainName{Name: labels[keys.Name+suffix], Zone: zone}
+		if indexedZone, ok := labels[keys.Zone+suffix]; ok && indexedZone != "" {
+			name.Zone = indexedZone
+		}
+
+		if name.Name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return uniqueNames(names)
+}
+
+func splitNames(label, zone string) []DomainName {
+	var names []DomainName
+	for _, name := range strings.Split(label, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, DomainName{Name: name, Zone: zone})
+		}
+	}
+
+	return uniqueNames(names)
+}
+
+func uniqueNames(names []DomainName) []DomainName {
+	seen := make(map[DomainName]bool)
+	var unique []DomainName
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
 	}
 
-	domainName, ok := containerLabels[DomainNameKey]
+	return unique
+}
+
+// parsePorts parses the JR_DOMAIN_PORTS label, a comma separated list of
+// name:port[/proto], e.g. "http:8080,dns:53/udp"
+func parsePorts(label string) ([]PortInfo, error) {
+	var ports []PortInfo
+	for _, item := range strings.Split(label, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		nameAndPort := strings.SplitN(item, ":", 2)
+		if len(nameAndPort) != 2 || nameAndPort[0] == "" {
+			return nil, fmt.Errorf("invalid port %q, want name:port[/proto]", item)
+		}
+
+		port := docker.Port(nameAndPort[1])
+		portNumber, err := strconv.Atoi(port.Port())
+		if err != nil || portNumber <= 0 || portNumber > 65535 {
+			return nil, fmt.Errorf("invalid port number in %q", item)
+		}
+
+		ports = append(ports, PortInfo{Name: nameAndPort[0], Port: portNumber, Proto: port.Proto()})
+	}
+
+	return ports, nil
+}
+
+func intLabel(labels map[string]string, key string) int {
+	value, ok := labels[key]
 	if !ok {
-		return nil, errors.New("get container domain name info failed: null response")
+		return 0
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		log.Warnf("ignore invalid label %s=%s", key, value)
+		return 0
 	}
 
-	var ip string
-	for _, value := range containerInfo.NetworkSettings.Networks {
-		ip = value.IPAddress
+	return number
+}
+
+// reverseZone derives the reverse zone from the pool the ip was allocated
+// from, falling back to the /24 (/64 for IPv6) around the ip
+func reverseZone(ip string) string {
+	mask := 24
+	if net.ParseIP(ip).To4() == nil {
+		mask = 64
 	}
 
-	if ip == "" {
-		return nil, errors.New("container ip is empty")
+	if poolConfig, err := ipamdriver.FindConfigByIP(ip); err != nil {
+		log.Warnf("find pool of ip %s failed, use /%d as reverse zone. Error: %s", ip, mask, err.Error())
+	} else if poolMask, err := strconv.Atoi(poolConfig.Mask); err == nil {
+		mask = poolMask
+	}
+
+	zone, err := dns.ReverseZone(ip, mask)
+	if err != nil {
+		log.Warnf("get reverse zone of ip %s failed. Error: %s", ip, err.Error())
+		return ""
+	}
+
+	return zone
+}
+
+func exposedPorts(ports map[docker.Port]struct{}) []PortInfo {
+	var portInfos []PortInfo
+	for port := range ports {
+		portNumber, err := strconv.Atoi(port.Port())
+		if err != nil {
+			continue
+		}
+
+		portInfos = append(portInfos, PortInfo{Name: port.Port(), Port: portNumber, Proto: port.Proto()})
 	}
 
-	return &ContainerIPInfo{Domain: domainName, Zone: domainMain, IP: ip}, nil
+	sort.Slice(portInfos, func(i, j int) bool { return portInfos[i].Port < portInfos[j].Port })
+	return portInfos
 }
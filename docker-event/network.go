@@ -0,0 +1,80 @@
+package event
+
+import (
+	"sort"
+
+	docker "github.com/upccup/july/docker-client"
+	"github.com/upccup/july/ipamdriver"
+	"github.com/upccup/july/networkdriver"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// julyAddresses returns the container addresses on july networks, the
+// configured network first and then sorted by network name
+func (listener *DockerListener) julyAddresses(networks map[string]docker.ContainerNetwork) []NetworkIP {
+	var names []string
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var addresses []NetworkIP
+	for _, name := range names {
+		network := networks[name]
+		if network.IPAddress == "" || !listener.isJulyNetwork(name, network.NetworkID) {
+			continue
+		}
+
+		address := NetworkIP{Network: name, IP: network.IPAddress}
+		if name == listener.NetworkName {
+			addresses = append([]NetworkIP{address}, addresses...)
+		} else {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// onJulyNetwork tells whether a container is attached to a july network,
+// with an address or not
+func (listener *DockerListener) onJulyNetwork(networks map[string]docker.ContainerNetwork) bool {
+	for name, network := range networks {
+		if listener.isJulyNetwork(name, network.NetworkID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isJulyNetwork tells whether the container addresses on a network are
+// published: the network set with --dns-network, or else any network using
+// the july IPAM or network driver
+func (listener *DockerListener) isJulyNetwork(name, ID string) bool {
+	if listener.NetworkName != "" {
+		return name == listener.NetworkName
+	}
+
+	listener.networksLock.Lock()
+	defer listener.networksLock.Unlock()
+
+	if julyNetwork, ok := listener.julyNetworks[ID]; ok {
+		return julyNetwork
+	}
+
+	network, err := listener.DockerClient.NetworkInfo(ID)
+	if err != nil {
+		log.Errorf("inspect network %s failed. Error: %s", name, err.Error())
+		return false
+	}
+
+	julyNetwork := network.IPAM.Driver == ipamdriver.DriverName || network.Driver == networkdriver.DriverName
+	if listener.julyNetworks == nil {
+		listener.julyNetworks = make(map[string]bool)
+	}
+	listener.julyNetworks[ID] = julyNetwork
+
+	return julyNetwork
+}
@@ -0,0 +1,313 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+	dns "github.com/upccup/july/dns-handler"
+	docker "github.com/upccup/july/docker-client"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+)
+
+const DefaultReconcileInterval = 5 * time.Minute
+
+// Reconcile brings the stored container domains and the DNS backend in line
+// with the containers running on this host: containers started while july
+// was down are published, the ones which died meanwhile are removed.
+func (listener *DockerListener) Reconcile() error {
+	containers, err := listener.DockerClient.ListContainers(docker.ListContainersOptions{
+		Filters: listener.domainFilters(),
+	})
+	if err != nil {
+		return err
+	}
+
+	stored, err := StoredContainerIPInfos()
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*ContainerIPInfo)
+	for _, container := range containers {
+		info, err := listener.syncContainer(container.ID, stored[container.ID], container.Status)
+		if err != nil {
+			logContainerInfoError(err, "reconcile")
+			continue
+		}
+
+		if info != nil {
+			running[container.ID] = info
+		}
+	}
+
+	for ID, info := range stored {
+		if _, ok := running[ID]; ok || !listener.ownsStaleInfo(ID, info) {
+			continue
+		}
+
+		log.Infof("container %s is gone, remove its domain %s", ID, info.Domain)
+		listener.health.cancel(ID)
+		if !info.Withdrawn {
+			listener.deleteRecords(info)
+		}
+
+		if err := db.DeleteKey(filepath.Join(config.ContainerDomainsStorePath, ID)); err != nil {
+			log.Errorf("delete container %s domain failed. Error: %s", ID, err.Error())
+		}
+	}
+
+	for ID, info := range running {
+		stored[ID] = info
+	}
+
+	// the swarm tasks own the service records
+	services, err := storedServiceInfos()
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]bool)
+	for ID := range stored {
+		owners[ID] = true
+	}
+	for _, service := range services {
+		for taskID := range service.Tasks {
+			owners[taskID] = true
+		}
+	}
+
+	return listener.reconcileBackend(running, stored, owners)
+}
+
+// syncContainer publishes the current records of a running container and
+// deletes the ones of its stored info which changed. It returns nil when the
+// container has no domain any more. status is the docker status line, which
+// carries the health of the container, e.g. "Up 2 hours (healthy)"; an empty
+// status keeps the health state of the stored info.
+func (listener *DockerListener) syncContainer(ID string, stored *ContainerIPInfo, status string) (*ContainerIPInfo, error) {
+	var oldRecords []dns.Record
+	if stored != nil && !stored.Withdrawn {
+		oldRecords = stored.Records()
+	}
+
+	info, err := listener.GetContainerIPInfo(ID)
+	if err != nil {
+		if stored == nil || ErrorReason(err) == ReasonInspectFailed {
+			return nil, err
+		}
+
+		log.Warnf("container %s has no domain any more: %s", ID, err.Error())
+		for _, record := range oldRecords {
+			listener.DNSProvider.DeleteRecord(record)
+		}
+		return nil, db.DeleteKey(filepath.Join(config.ContainerDomainsStorePath, ID))
+	}
+
+	info.Withdrawn = info.HealthCheck && !strings.Contains(status, "(healthy)")
+	if status == "" && stored != nil {
+		info.Withdrawn = info.HealthCheck && stored.Withdrawn
+	} else if info.Withdrawn && stored != nil && !stored.Withdrawn && strings.Contains(status, "(unhealthy)") {
+		// a published container keeps its records for the grace period
+		info.Withdrawn = false
+		defer listener.handleUnhealthy(ID)
+	}
+	var newRecords []dns.Record
+	if !info.Withdrawn {
+		newRecords = info.Records()
+	}
+
+	if err := storeContainerIPInfo(ID, info); err != nil {
+		return nil, err
+	}
+
+	for _, record := range oldRecords {
+		if !containsRecord(newRecords, record) {
+			log.Infof("reconcile: delete changed record %s", record)
+			listener.DNSProvider.DeleteRecord(record)
+		}
+	}
+
+	for _, record := range newRecords {
+		if stored == nil || !containsRecord(oldRecords, record) {
+			log.Infof("reconcile: add record %s", record)
+			listener.DNSProvider.AddRecord(record)
+		}
+	}
+
+	return info, nil
+}
+
+// ownsStaleInfo tells whether the stored info of a container which is not
+// running here belongs to this host, infos stored before the host was
+// recorded are checked against the docker daemon
+func (listener *DockerListener) ownsStaleInfo(ID string, info *ContainerIPInfo) bool {
+	if info.Host != "" {
+		return info.Host == listener.HostID
+	}
+
+	container, err := listener.DockerClient.InspectContainer(ID)
+	if err != nil {
+		return false
+	}
+
+	return !container.State.Running
+}
+
+// reconcileBackend adds the published records missing from the backend and
+// deletes the owned records whose container or swarm task has no stored
+// domain at all. It is skipped for backends which can't list their records.
+func (listener *DockerListener) reconcileBackend(running, stored map[string]*ContainerIPInfo, owners map[string]bool) error {
+	zones := make(map[string][]dns.Record)
+	for _, info := range stored {
+		for _, record := range info.Records() {
+			if _, ok := zones[record.Zone]; !ok {
+				zones[record.Zone] = nil
+			}
+		}
+	}
+
+	for _, info := range running {
+		if info.Withdrawn {
+			continue
+		}
+		for _, record := range info.Records() {
+			zones[record.Zone] = append(zones[record.Zone], record)
+		}
+	}
+
+	for zone, published := range zones {
+		existing, err := listener.DNSProvider.ListRecords(zone)
+		if err == dns.ErrListNotSupported {
+			log.Debug("dns backend can't list records, skip reconciling it")
+			return nil
+		}
+
+		if err != nil {
+			log.Errorf("list dns records of zone %s failed. Error: %s", zone, err.Error())
+			continue
+		}
+
+		keys := make(map[string]bool)
+		for _, record := range existing {
+			keys[recordKey(record)] = true
+
+			if record.Owner == "" || isOwner(owners, record.Owner) {
+				continue
+			}
+
+			log.Infof("reconcile: delete orphan record %s", record)
+			listener.DNSProvider.DeleteRecord(record)
+		}
+
+		for _, record := range published {
+			if !keys[recordKey(record)] {
+				log.Infof("reconcile: add missing record %s", record)
+				listener.DNSProvider.AddRecord(record)
+			}
+		}
+	}
+
+	return nil
+}
+
+// domainFilters selects the containers or services with a zone label, or all
+// of them when there is a default zone
+func (listener *DockerListener) domainFilters() map[string][]string {
+	if listener.DefaultZone != "" {
+		return nil
+	}
+
+	return map[string][]string{"label": {listener.labelKeys().Zone}}
+}
+
+// StoredContainerIPInfos returns the domains of every host by container ID
+func StoredContainerIPInfos() (map[string]*ContainerIPInfo, error) {
+	infos := make(map[string]*ContainerIPInfo)
+	nodes, err := db.GetKeys(config.ContainerDomainsStorePath)
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return infos, nil
+		}
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		var info ContainerIPInfo
+		if err := json.Unmarshal([]byte(node.Value), &info); err != nil {
+			log.Warnf("skip invalid container domain %s: %s", node.Key, err.Error())
+			continue
+		}
+		infos[filepath.Base(node.Key)] = &info
+	}
+
+	return infos, nil
+}
+
+// isOwner matches the owner label of a backend record, which may be a prefix
+// of the container or task ID
+func isOwner(owners map[string]bool, owner string) bool {
+	for ID := range owners {
+		if strings.HasPrefix(ID, owner) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsRecord(records []dns.Record, record dns.Record) bool {
+	for _, r := range records {
+		if r == record {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordKey identifies a record regardless of how the backend spells it
+func recordKey(record dns.Record) string {
+	return strings.ToLower(fmt.Sprintf("%s %s %s %d", strings.TrimSuffix(record.FQDN(), "."),
+		record.Type, strings.TrimSuffix(record.Value, "."), record.Port))
+}
+
+// missingRecords returns the records the backend doesn't have. Backends which
+// can't list their records are assumed to have the known ones.
+func (listener *DockerListener) missingRecords(records, known []dns.Record) []dns.Record {
+	zones := make(map[string]map[string]bool)
+	var missing []dns.Record
+	for _, record := range records {
+		existing, ok := zones[record.Zone]
+		if !ok {
+			listed, err := listener.DNSProvider.ListRecords(record.Zone)
+			if err != nil {
+				if err != dns.ErrListNotSupported {
+					log.Errorf("list dns records of zone %s failed. Error: %s", record.Zone, err.Error())
+				}
+			} else {
+				existing = make(map[string]bool)
+				for _, r := range listed {
+					existing[recordKey(r)] = true
+				}
+			}
+			zones[record.Zone] = existing
+		}
+
+		if existing != nil {
+			if !existing[recordKey(record)] {
+				missing = append(missing, record)
+			}
+		} else if !containsRecord(known, record) {
+			missing = append(missing, record)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,262 @@
+package event
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+	dns "github.com/upccup/july/dns-handler"
+	docker "github.com/upccup/july/docker-client"
+	"github.com/upccup/july/ipamdriver"
+	"github.com/upccup/july/networkdriver"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/client"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+const (
+	EventTypeService = "service"
+
+	DefaultServiceSyncInterval = 10 * time.Second
+)
+
+// ServiceInfo is a swarm service published under its JR_DOMAIN_* labels,
+// every running task on a july network has the records of a container
+// owned by the task ID, so the service name resolves to all of them.
+type ServiceInfo struct {
+	ID    string
+	Name  string
+	Tasks map[string]*ContainerIPInfo
+}
+
+// Records returns the records of every task of the service
+func (info *ServiceInfo) Records() []dns.Record {
+	var records []dns.Record
+	for _, task := range info.Tasks {
+		records = append(records, task.Records()...)
+	}
+
+	return records
+}
+
+// triggerServiceSync asks the service loop to sync now, e.g. on a service
+// event, swarm sends no event when a task is rescheduled so it also polls
+func (listener *DockerListener) triggerServiceSync() {
+	select {
+	case listener.serviceSync <- struct{}{}:
+	default:
+	}
+}
+
+// syncServicesLoop keeps the service records in line with the running tasks.
+// Only the swarm leader publishes them, so there is one writer cluster-wide.
+func (listener *DockerListener) syncServicesLoop() {
+	interval := listener.ServiceSyncInterval
+	if interval <= 0 {
+		interval = DefaultServiceSyncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if listener.isSwarmLeader() {
+			if err := listener.SyncServices(); err != nil {
+				log.Errorf("sync swarm services failed. Error: %s", err.Error())
+			}
+		}
+
+		select {
+		case <-listener.serviceSync:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (listener *DockerListener) isSwarmLeader() bool {
+	dockerInfo, err := listener.DockerClient.Info()
+	if err != nil {
+		log.Errorf("get docker info failed. Error: %s", err.Error())
+		return false
+	}
+
+	if !dockerInfo.Swarm.ControlAvailable {
+		return false
+	}
+
+	node, err := listener.DockerClient.InspectNode(dockerInfo.Swarm.NodeID)
+	if err != nil {
+		log.Errorf("inspect swarm node %s failed. Error: %s", dockerInfo.Swarm.NodeID, err.Error())
+		return false
+	}
+
+	return node.ManagerStatus != nil && node.ManagerStatus.Leader
+}
+
+// SyncServices publishes the tasks of the services with a domain and
+// removes the services and tasks which are gone
+func (listener *DockerListener) SyncServices() error {
+	services, err := listener.DockerClient.ListServices(docker.ListServicesOptions{
+		Filters: listener.domainFilters(),
+	})
+	if err != nil {
+		return err
+	}
+
+	stored, err := storedServiceInfos()
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]bool)
+	for _, service := range services {
+		running[service.ID] = true
+		if err := listener.syncService(service, stored[service.ID]); err != nil {
+			log.Errorf("sync service %s failed. Error: %s", service.Spec.Name, err.Error())
+		}
+	}
+
+	for ID, info := range stored {
+		if running[ID] {
+			continue
+		}
+
+		log.Infof("service %s is gone, remove its domain", info.Name)
+		for _, record := range info.Records() {
+			listener.DNSProvider.DeleteRecord(record)
+		}
+
+		if err := db.DeleteKey(filepath.Join(config.ServiceDomainsStorePath, ID)); err != nil {
+			log.Errorf("delete service %s domain failed. Error: %s", info.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (listener *DockerListener) syncService(service swarm.Service, stored *ServiceInfo) error {
+	tasks, err := listener.DockerClient.ListTasks(docker.ListTasksOptions{
+		Filters: map[string][]string{"service": {service.ID}, "desired-state": {"running"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	info := &ServiceInfo{ID: service.ID, Name: service.Spec.Name, Tasks: make(map[string]*ContainerIPInfo)}
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+
+		if taskInfo := listener.taskIPInfo(service, task); taskInfo != nil {
+			info.Tasks[task.ID] = taskInfo
+		}
+	}
+
+	var oldRecords []dns.Record
+	if stored != nil {
+		oldRecords = stored.Records()
+	}
+	newRecords := info.Records()
+
+	for _, record := range oldRecords {
+		if !containsRecord(newRecords, record) {
+			log.Infof("service %s: delete record %s", info.Name, record)
+			listener.DNSProvider.DeleteRecord(record)
+		}
+	}
+
+	// records deleted meanwhile, e.g. by a reconcile, are added again too
+	for _, record := range listener.missingRecords(newRecords, oldRecords) {
+		log.Infof("service %s: add record %s", info.Name, record)
+		listener.DNSProvider.AddRecord(record)
+	}
+
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return db.SetKey(filepath.Join(config.ServiceDomainsStorePath, service.ID), string(infoBytes))
+}
+
+// taskIPInfo builds the records of a task from the service labels, it is
+// nil when the task has no address on a july network
+func (listener *DockerListener) taskIPInfo(service swarm.Service, task swarm.Task) *ContainerIPInfo {
+	var addresses []NetworkIP
+	for _, attachment := range task.NetworksAttachments {
+		if !listener.isJulySwarmNetwork(attachment.Network) {
+			continue
+		}
+
+		for _, address := range attachment.Addresses {
+			ip := strings.SplitN(address, "/", 2)[0]
+			addresses = append(addresses, NetworkIP{Network: attachment.Network.Spec.Name, IP: ip})
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	info, err := listener.domainInfo(service.Spec.Labels, NameData{
+		ID:     service.ID,
+		Name:   service.Spec.Name,
+		Labels: service.Spec.Labels,
+	})
+	if err != nil {
+		log.Warnf("skip service %s: %s", service.Spec.Name, err.Error())
+		return nil
+	}
+
+	info.ID = task.ID
+	info.IP = addresses[0].IP
+	info.Networks = addresses
+
+	if listener.EnablePTR {
+		for i := range info.Networks {
+			info.Networks[i].ReverseZone = reverseZone(info.Networks[i].IP)
+		}
+		info.ReverseZone = info.Networks[0].ReverseZone
+	}
+
+	return info
+}
+
+func (listener *DockerListener) isJulySwarmNetwork(network swarm.Network) bool {
+	if listener.NetworkName != "" {
+		return network.Spec.Name == listener.NetworkName
+	}
+
+	if network.IPAMOptions != nil && network.IPAMOptions.Driver.Name == ipamdriver.DriverName {
+		return true
+	}
+
+	return network.DriverState.Name == networkdriver.DriverName
+}
+
+func storedServiceInfos() (map[string]*ServiceInfo, error) {
+	infos := make(map[string]*ServiceInfo)
+	nodes, err := db.GetKeys(config.ServiceDomainsStorePath)
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return infos, nil
+		}
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		var info ServiceInfo
+		if err := json.Unmarshal([]byte(node.Value), &info); err != nil {
+			log.Warnf("skip invalid service domain %s: %s", node.Key, err.Error())
+			continue
+		}
+		infos[filepath.Base(node.Key)] = &info
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,131 @@
+package event
+
+import (
+	"expvar"
+	"hash/fnv"
+	"sync"
+
+	docker "github.com/upccup/july/docker-client"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	DefaultEventWorkers   = 4
+	DefaultEventQueueSize = 100
+
+	// QueuePolicyBlock stops reading docker events while the queue of a
+	// worker is full, QueuePolicyDrop drops the event and leaves it to the
+	// next reconcile
+	QueuePolicyBlock = "block"
+	QueuePolicyDrop  = "drop"
+)
+
+var (
+	eventsProcessed = expvar.NewInt("events_processed")
+	eventsDropped   = expvar.NewInt("events_dropped")
+	eventsBlocked   = expvar.NewInt("events_blocked")
+	eventsQueued    = expvar.NewInt("events_queued")
+)
+
+// eventPool runs the events on a fixed set of workers. Events are sharded by
+// container, so the events of one container are handled in order.
+type eventPool struct {
+	listener *DockerListener
+	queues   []chan *docker.APIEvents
+	drop     bool
+
+	// inflight counts the dispatched events until they are handled
+	inflight sync.WaitGroup
+	workers  sync.WaitGroup
+}
+
+func newEventPool(listener *DockerListener) *eventPool {
+	workers := listener.Workers
+	if workers <= 0 {
+		workers = DefaultEventWorkers
+	}
+
+	queueSize := listener.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultEventQueueSize
+	}
+
+	pool := &eventPool{
+		listener: listener,
+		drop:     listener.QueuePolicy == QueuePolicyDrop,
+	}
+
+	for i := 0; i < workers; i++ {
+		queue := make(chan *docker.APIEvents, queueSize)
+		pool.queues = append(pool.queues, queue)
+		pool.workers.Add(1)
+		go pool.work(queue)
+	}
+
+	return pool
+}
+
+func (pool *eventPool) work(queue chan *docker.APIEvents) {
+	defer pool.workers.Done()
+	for e := range queue {
+		eventsQueued.Add(-1)
+		pool.listener.HandleDockerEvent(e)
+		pool.listener.checkpoint(e)
+		eventsProcessed.Add(1)
+		pool.inflight.Done()
+	}
+}
+
+// dispatch queues e on the worker of its container
+func (pool *eventPool) dispatch(e *docker.APIEvents) {
+	queue := pool.queues[shard(e, len(pool.queues))]
+	// a retry keeps the time of its event, which is checkpointed already
+	if !isRetry(e) {
+		pool.listener.tracker.add(eventTime(e))
+	}
+	pool.inflight.Add(1)
+	eventsQueued.Add(1)
+
+	select {
+	case queue <- e:
+		return
+	default:
+	}
+
+	if pool.drop {
+		log.Warnf("event queue is full, drop %s event of %s", e.Action, e.ID)
+		eventsQueued.Add(-1)
+		eventsDropped.Add(1)
+		pool.listener.checkpoint(e)
+		pool.inflight.Done()
+		return
+	}
+
+	eventsBlocked.Add(1)
+	queue <- e
+}
+
+// wait blocks until every dispatched event is handled
+func (pool *eventPool) wait() {
+	pool.inflight.Wait()
+}
+
+// stop handles the queued events and stops the workers
+func (pool *eventPool) stop() {
+	for _, queue := range pool.queues {
+		close(queue)
+	}
+	pool.workers.Wait()
+}
+
+func shard(e *docker.APIEvents, shards int) int {
+	key := e.ID
+	if e.Type == EventTypeNetwork {
+		key = e.Actor.Attributes["container"]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
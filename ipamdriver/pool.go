@@ -0,0 +1,105 @@
+package ipamdriver
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"sort"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+
+	"github.com/coreos/etcd/client"
+)
+
+// Pool is a container ip pool with its free and assigned addresses.
+// Network is the key of the pool in the store, Subnet its CIDR
+type Pool struct {
+	Network  string
+	Subnet   string
+	Free     []string
+	Assigned []string
+}
+
+// ListPools returns the container ip pools sorted by subnet, only the one
+// of subnet when it isn't empty. subnet is a CIDR or the network address
+func ListPools(subnet string) ([]*Pool, error) {
+	containerNets, err := db.GetKeys(config.ContainerIPStorePrefix)
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pools []*Pool
+	for _, containerNet := range containerNets {
+		network := filepath.Base(containerNet.Key)
+		pool := &Pool{Network: network, Subnet: network}
+		if conf, err := GetConfig(network); err == nil && conf.Mask != "" {
+			pool.Subnet = conf.Ipnet + "/" + conf.Mask
+		}
+
+		if subnet != "" && !pool.matches(subnet) {
+			continue
+		}
+
+		if pool.Free, err = poolIPs(config.ContainerIPPoolSotrePath(network)); err != nil {
+			return nil, err
+		}
+
+		if pool.Assigned, err = poolIPs(config.ContainerAssignedIPSotrePath(network)); err != nil {
+			return nil, err
+		}
+
+		pools = append(pools, pool)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return compareIPs(pools[i].Network, pools[j].Network) < 0
+	})
+
+	return pools, nil
+}
+
+func (pool *Pool) matches(subnet string) bool {
+	if subnet == pool.Subnet || subnet == pool.Network {
+		return true
+	}
+
+	// 192.168.1.5/24 is the subnet 192.168.1.0/24 too
+	_, ipNet, err := net.ParseCIDR(subnet)
+	return err == nil && ipNet.String() == pool.Subnet
+}
+
+// poolIPs returns the addresses stored under dir sorted, a missing dir is
+// an empty pool
+func poolIPs(dir string) ([]string, error) {
+	nodes, err := db.GetKeys(dir)
+	if err != nil {
+		if client.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ips = append(ips, filepath.Base(node.Key))
+	}
+
+	sort.Slice(ips, func(i, j int) bool {
+		return compareIPs(ips[i], ips[j]) < 0
+	})
+
+	return ips, nil
+}
+
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return bytes.Compare([]byte(a), []byte(b))
+	}
+
+	return bytes.Compare(ipA.To16(), ipB.To16())
+}
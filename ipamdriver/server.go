@@ -4,17 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
 	"strings"
 
 	"github.com/upccup/july/config"
 	"github.com/upccup/july/db"
 	"github.com/upccup/july/util"
+	"github.com/upccup/july/webhook"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/go-plugins-helpers/ipam"
 )
 
+// DriverName is the name docker knows the july IPAM driver by
+const DriverName = "jdjr"
+
 type Config struct {
 	Ipnet string
 	Mask  string
@@ -23,7 +28,7 @@ type Config struct {
 func StartServer() {
 	d := &MyIPAMHandler{}
 	h := ipam.NewHandler(d)
-	h.ServeUnix("root", "jdjr")
+	h.ServeUnix("root", DriverName)
 }
 
 func AllocateIPRange(ip_start, ip_end string) []string {
@@ -61,6 +66,7 @@ func ReleaseIP(ipNet, ip string) error {
 	}
 
 	log.Infof("Release IP %s", ip)
+	webhook.Notify(webhook.EventIPReleased, webhook.IPData{Network: ipNet, IP: ip})
 	return nil
 }
 
@@ -89,6 +95,7 @@ func AllocateIP(ipNet, ip string) (string, error) {
 
 	db.SetKey(filepath.Join(config.ContainerAssignedIPSotrePath(ipNet), ip), "")
 	log.Infof("Allocated IP %s", ip)
+	webhook.Notify(webhook.EventIPAllocated, webhook.IPData{Network: ipNet, IP: ip})
 	return ip, err
 }
 
@@ -128,3 +135,30 @@ func GetConfig(ipNet string) (*Config, error) {
 	json.Unmarshal([]byte(config), conf)
 	return conf, err
 }
+
+// FindConfigByIP returns the config of the container pool the ip belongs to
+func FindConfigByIP(ip string) (*Config, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid ip %s", ip)
+	}
+
+	containerNets, err := db.GetKeys(config.ContainerIPStorePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, containerNet := range containerNets {
+		conf, err := GetConfig(filepath.Base(containerNet.Key))
+		if err != nil {
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(conf.Ipnet + "/" + conf.Mask)
+		if err == nil && ipNet.Contains(parsedIP) {
+			return conf, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no container pool contains ip %s", ip)
+}
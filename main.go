@@ -16,30 +16,22 @@ func main() {
 	app.Version = "1.0.0"
 	app.Author = "upccup"
 	app.Usage = "docker network plugin with remote IPAM & event listener"
-	app.Flags = []cli.Flag{
-		cli.StringFlag{Name: "cluster-store", Value: "http://127.0.0.1:2379", Usage: "the key/value store endpoint url. [$CLUSTER_STORE]"},
-		cli.BoolFlag{Name: "debug", Usage: "debug mode [$DEBUG]"},
-	}
+	app.Flags = command.GlobalFlags()
 	app.Before = InitConfig
-	app.Commands = []cli.Command{
-		command.NewServerCommand(),
-		command.NewIPRangeCommand(),
-		command.NewAddHostCommand(),
-		command.NewReleaseIPCommand(),
-		command.NewReleaseHostCommand(),
-		command.NewCreateNetworkCommand(),
-		command.NewShowAssignedIPCommand(),
-		command.NewShowIPPoolCommand(),
-		command.NewAddContainerIPCommand(),
-	}
+	app.Commands = command.Commands()
 	app.Run(os.Args)
 }
 
 func InitConfig(c *cli.Context) error {
-	initialize_log(c.GlobalBool("debug"))
+	if err := command.LoadConfigFile(c); err != nil {
+		log.Fatalf("load config file got error: %+v", err)
+		return err
+	}
+
+	initialize_log(command.GlobalBool(c, "debug"))
 
-	log.Info("cluster-store endpoint: ", c.GlobalString("cluster-store"))
-	db.SetDBAddr(c.GlobalString("cluster-store"))
+	log.Info("cluster-store endpoint: ", command.GlobalString(c, "cluster-store"))
+	db.SetDBAddr(command.GlobalString(c, "cluster-store"))
 	return nil
 }
 
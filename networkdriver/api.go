@@ -0,0 +1,261 @@
+package networkdriver
+
+import (
+	"net/http"
+
+	"github.com/docker/go-plugins-helpers/sdk"
+)
+
+const (
+	manifest = `{"Implements": ["NetworkDriver"]}`
+
+	capabilitiesPath   = "/NetworkDriver.GetCapabilities"
+	createNetworkPath  = "/NetworkDriver.CreateNetwork"
+	deleteNetworkPath  = "/NetworkDriver.DeleteNetwork"
+	createEndpointPath = "/NetworkDriver.CreateEndpoint"
+	endpointInfoPath   = "/NetworkDriver.EndpointOperInfo"
+	deleteEndpointPath = "/NetworkDriver.DeleteEndpoint"
+	joinPath           = "/NetworkDriver.Join"
+	leavePath          = "/NetworkDriver.Leave"
+	discoverNewPath    = "/NetworkDriver.DiscoverNew"
+	discoverDeletePath = "/NetworkDriver.DiscoverDelete"
+	programExtConnPath = "/NetworkDriver.ProgramExternalConnectivity"
+	revokeExtConnPath  = "/NetworkDriver.RevokeExternalConnectivity"
+)
+
+const (
+	LocalScope  = "local"
+	GlobalScope = "global"
+)
+
+// Driver represent the interface a remote network driver must fulfill.
+type Driver interface {
+	GetCapabilities() (*CapabilitiesResponse, error)
+	CreateNetwork(*CreateNetworkRequest) error
+	DeleteNetwork(*DeleteNetworkRequest) error
+	CreateEndpoint(*CreateEndpointRequest) (*CreateEndpointResponse, error)
+	EndpointInfo(*InfoRequest) (*InfoResponse, error)
+	DeleteEndpoint(*DeleteEndpointRequest) error
+	Join(*JoinRequest) (*JoinResponse, error)
+	Leave(*LeaveRequest) error
+}
+
+// CapabilitiesResponse returns the scope of the driver
+type CapabilitiesResponse struct {
+	Scope string
+}
+
+// IPAMData contains the address pool information the IPAM driver handed out
+type IPAMData struct {
+	AddressSpace string
+	Pool         string
+	Gateway      string
+	AuxAddresses map[string]interface{}
+}
+
+// CreateNetworkRequest is sent by the daemon when a network needs to be created
+type CreateNetworkRequest struct {
+	NetworkID string
+	Options   map[string]interface{}
+	IPv4Data  []*IPAMData
+	IPv6Data  []*IPAMData
+}
+
+// DeleteNetworkRequest is sent by the daemon when a network needs to be removed
+type DeleteNetworkRequest struct {
+	NetworkID string
+}
+
+// EndpointInterface represents an interface endpoint
+type EndpointInterface struct {
+	Address     string
+	AddressIPv6 string
+	MacAddress  string
+}
+
+// CreateEndpointRequest is sent by the daemon when an endpoint should be created
+type CreateEndpointRequest struct {
+	NetworkID  string
+	EndpointID string
+	Interface  *EndpointInterface
+	Options    map[string]interface{}
+}
+
+// CreateEndpointResponse is sent as a response to a CreateEndpointRequest, the
+// interface fields must only be filled in when the daemon left them empty
+type CreateEndpointResponse struct {
+	Interface *EndpointInterface `json:",omitempty"`
+}
+
+// InfoRequest is sent by the daemon when querying endpoint information
+type InfoRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// InfoResponse is endpoint information sent in response to an InfoRequest
+type InfoResponse struct {
+	Value map[string]string
+}
+
+// DeleteEndpointRequest is sent by the daemon when an endpoint needs to be removed
+type DeleteEndpointRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// JoinRequest is sent by the daemon when an endpoint needs be joined to a sandbox
+type JoinRequest struct {
+	NetworkID  string
+	EndpointID string
+	SandboxKey string
+	Options    map[string]interface{}
+}
+
+// InterfaceName consists of the name of the interface in the global netns and
+// the desired prefix to be appended to the interface inside the container netns
+type InterfaceName struct {
+	SrcName   string
+	DstPrefix string
+}
+
+// StaticRoute contains static route information
+type StaticRoute struct {
+	Destination string
+	RouteType   int
+	NextHop     string
+}
+
+// JoinResponse is sent in response to a JoinRequest
+type JoinResponse struct {
+	InterfaceName         InterfaceName
+	Gateway               string
+	GatewayIPv6           string
+	StaticRoutes          []*StaticRoute
+	DisableGatewayService bool
+}
+
+// LeaveRequest is sent by the daemon when an endpoint needs to leave a sandbox
+type LeaveRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// ErrorResponse is a formatted error message that libnetwork can understand
+type ErrorResponse struct {
+	Err string
+}
+
+// NewErrorResponse creates an ErrorResponse with the provided message
+func NewErrorResponse(msg string) *ErrorResponse {
+	return &ErrorResponse{Err: msg}
+}
+
+// Handler forwards requests and responses between the docker daemon and the plugin.
+type Handler struct {
+	driver Driver
+	sdk.Handler
+}
+
+// NewHandler initializes the request handler with a driver implementation.
+func NewHandler(driver Driver) *Handler {
+	h := &Handler{driver, sdk.NewHandler(manifest)}
+	h.initMux()
+	return h
+}
+
+func (h *Handler) initMux() {
+	h.HandleFunc(capabilitiesPath, func(w http.ResponseWriter, r *http.Request) {
+		res, err := h.driver.GetCapabilities()
+		if err != nil {
+			msg := err.Error()
+			sdk.EncodeResponse(w, NewErrorResponse(msg), msg)
+			return
+		}
+		sdk.EncodeResponse(w, res, "")
+	})
+	h.HandleFunc(createNetworkPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &CreateNetworkRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		h.encodeEmpty(w, h.driver.CreateNetwork(req))
+	})
+	h.HandleFunc(deleteNetworkPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &DeleteNetworkRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		h.encodeEmpty(w, h.driver.DeleteNetwork(req))
+	})
+	h.HandleFunc(createEndpointPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &CreateEndpointRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		res, err := h.driver.CreateEndpoint(req)
+		if err != nil {
+			msg := err.Error()
+			sdk.EncodeResponse(w, NewErrorResponse(msg), msg)
+			return
+		}
+		sdk.EncodeResponse(w, res, "")
+	})
+	h.HandleFunc(endpointInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &InfoRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		res, err := h.driver.EndpointInfo(req)
+		if err != nil {
+			msg := err.Error()
+			sdk.EncodeResponse(w, NewErrorResponse(msg), msg)
+			return
+		}
+		sdk.EncodeResponse(w, res, "")
+	})
+	h.HandleFunc(deleteEndpointPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &DeleteEndpointRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		h.encodeEmpty(w, h.driver.DeleteEndpoint(req))
+	})
+	h.HandleFunc(joinPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &JoinRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		res, err := h.driver.Join(req)
+		if err != nil {
+			msg := err.Error()
+			sdk.EncodeResponse(w, NewErrorResponse(msg), msg)
+			return
+		}
+		sdk.EncodeResponse(w, res, "")
+	})
+	h.HandleFunc(leavePath, func(w http.ResponseWriter, r *http.Request) {
+		req := &LeaveRequest{}
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		h.encodeEmpty(w, h.driver.Leave(req))
+	})
+
+	// july does not take part in discovery or port mapping, these calls only
+	// need to be acknowledged
+	for _, path := range []string{discoverNewPath, discoverDeletePath, programExtConnPath, revokeExtConnPath} {
+		h.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			h.encodeEmpty(w, nil)
+		})
+	}
+}
+
+func (h *Handler) encodeEmpty(w http.ResponseWriter, err error) {
+	if err != nil {
+		msg := err.Error()
+		sdk.EncodeResponse(w, NewErrorResponse(msg), msg)
+		return
+	}
+	sdk.EncodeResponse(w, make(map[string]string), "")
+}
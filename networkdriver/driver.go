@@ -0,0 +1,330 @@
+package networkdriver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/upccup/july/config"
+	"github.com/upccup/july/db"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	DefaultBridge = "br0"
+
+	// docker puts the -o options of `docker network create` under this key
+	genericOptionKey  = "com.docker.network.generic"
+	bridgeOptionKey   = "com.docker.network.bridge.name"
+	containerIfPrefix = "eth"
+)
+
+type Network struct {
+	ID      string
+	Bridge  string
+	Subnet  string
+	Gateway string
+}
+
+type Endpoint struct {
+	ID            string
+	NetworkID     string
+	Address       string
+	MacAddress    string
+	HostVeth      string
+	ContainerVeth string
+}
+
+// BridgeDriver plugs every endpoint into an existing host bridge with a veth
+// pair and programs a static neighbor entry and a host route for it, so the
+// plumbing does not depend on docker's built-in bridge driver.
+type BridgeDriver struct {
+}
+
+func (d *BridgeDriver) GetCapabilities() (*CapabilitiesResponse, error) {
+	log.Infof("GetCapabilities")
+	return &CapabilitiesResponse{Scope: LocalScope}, nil
+}
+
+func (d *BridgeDriver) CreateNetwork(request *CreateNetworkRequest) error {
+	log.Infof("CreateNetwork: %#v", request)
+	if len(request.IPv4Data) == 0 || request.IPv4Data[0] == nil {
+		return errors.New("july network driver requires an IPv4 pool")
+	}
+
+	network := &Network{
+		ID:      request.NetworkID,
+		Bridge:  bridgeName(request.Options),
+		Subnet:  request.IPv4Data[0].Pool,
+		Gateway: request.IPv4Data[0].Gateway,
+	}
+
+	if err := ensureBridge(network.Bridge, gatewayCIDR(network)); err != nil {
+		return err
+	}
+
+	return storeJSON(config.NetworkDriverNetworkStorePath(network.ID), network)
+}
+
+func (d *BridgeDriver) DeleteNetwork(request *DeleteNetworkRequest) error {
+	log.Infof("DeleteNetwork: %#v", request)
+	return db.DeleteKey(config.NetworkDriverNetworkStorePath(request.NetworkID))
+}
+
+func (d *BridgeDriver) CreateEndpoint(request *CreateEndpointRequest) (*CreateEndpointResponse, error) {
+	log.Infof("CreateEndpoint: %#v", request)
+	if request.Interface == nil || request.Interface.Address == "" {
+		return nil, errors.New("july network driver requires an IPv4 address from IPAM")
+	}
+
+	ip, _, err := net.ParseCIDR(request.Interface.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CreateEndpointResponse{}
+	mac := request.Interface.MacAddress
+	if mac == "" {
+		mac = generateMacAddress(ip)
+		response.Interface = &EndpointInterface{MacAddress: mac}
+	}
+
+	endpoint := &Endpoint{
+		ID:            request.EndpointID,
+		NetworkID:     request.NetworkID,
+		Address:       request.Interface.Address,
+		MacAddress:    mac,
+		HostVeth:      "jl" + shortID(request.EndpointID),
+		ContainerVeth: "jc" + shortID(request.EndpointID),
+	}
+
+	if err := storeJSON(config.NetworkDriverEndpointStorePath(endpoint.ID), endpoint); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (d *BridgeDriver) EndpointInfo(request *InfoRequest) (*InfoResponse, error) {
+	log.Infof("EndpointInfo: %#v", request)
+	endpoint, err := getEndpoint(request.EndpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InfoResponse{Value: map[string]string{
+		"host_veth":   endpoint.HostVeth,
+		"mac_address": endpoint.MacAddress,
+	}}, nil
+}
+
+func (d *BridgeDriver) DeleteEndpoint(request *DeleteEndpointRequest) error {
+	log.Infof("DeleteEndpoint: %#v", request)
+	return db.DeleteKey(config.NetworkDriverEndpointStorePath(request.EndpointID))
+}
+
+func (d *BridgeDriver) Join(request *JoinRequest) (*JoinResponse, error) {
+	log.Infof("Join: %#v", request)
+	network, err := getNetwork(request.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := getEndpoint(request.EndpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, _, err := net.ParseCIDR(endpoint.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// a join which failed half way may have left the veth behind
+	if exec.Command("ip", "link", "show", endpoint.HostVeth).Run() == nil {
+		log.Warnf("veth %s of endpoint %s already exists, recreate it", endpoint.HostVeth, endpoint.ID)
+		if err := runIP(fmt.Sprintf("link del %s", endpoint.HostVeth)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := runIP(fmt.Sprintf("link add %s type veth peer name %s", endpoint.HostVeth, endpoint.ContainerVeth)); err != nil {
+		return nil, err
+	}
+
+	steps := []string{
+		fmt.Sprintf("link set %s address %s", endpoint.ContainerVeth, endpoint.MacAddress),
+		fmt.Sprintf("link set %s master %s", endpoint.HostVeth, network.Bridge),
+		fmt.Sprintf("link set %s up", endpoint.HostVeth),
+		fmt.Sprintf("neigh replace %s lladdr %s dev %s nud permanent", ip, endpoint.MacAddress, network.Bridge),
+		fmt.Sprintf("route replace %s/32 dev %s", ip, network.Bridge),
+	}
+
+	for _, step := range steps {
+		if err := runIP(step); err != nil {
+			runIP(fmt.Sprintf("link del %s", endpoint.HostVeth))
+			return nil, err
+		}
+	}
+
+	gateway := network.Gateway
+	if gatewayIP, _, err := net.ParseCIDR(gateway); err == nil {
+		gateway = gatewayIP.String()
+	}
+
+	return &JoinResponse{
+		InterfaceName: InterfaceName{SrcName: endpoint.ContainerVeth, DstPrefix: containerIfPrefix},
+		Gateway:       gateway,
+	}, nil
+}
+
+func (d *BridgeDriver) Leave(request *LeaveRequest) error {
+	log.Infof("Leave: %#v", request)
+	network, err := getNetwork(request.NetworkID)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := getEndpoint(request.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	ip, _, err := net.ParseCIDR(endpoint.Address)
+	if err != nil {
+		return err
+	}
+
+	// the cleanup is best effort, the kernel drops the route and the neighbor
+	// entry together with the veth in most cases
+	if err := runIP(fmt.Sprintf("route del %s/32 dev %s", ip, network.Bridge)); err != nil {
+		log.Warnf("delete route of endpoint %s failed. Error: %s", endpoint.ID, err.Error())
+	}
+
+	if err := runIP(fmt.Sprintf("neigh del %s dev %s", ip, network.Bridge)); err != nil {
+		log.Warnf("delete neighbor of endpoint %s failed. Error: %s", endpoint.ID, err.Error())
+	}
+
+	return runIP(fmt.Sprintf("link del %s", endpoint.HostVeth))
+}
+
+func bridgeName(options map[string]interface{}) string {
+	generic, ok := options[genericOptionKey].(map[string]interface{})
+	if !ok {
+		return DefaultBridge
+	}
+
+	for _, key := range []string{bridgeOptionKey, "bridge"} {
+		if name, ok := generic[key].(string); ok && name != "" {
+			return name
+		}
+	}
+
+	return DefaultBridge
+}
+
+// ensureBridge creates the bridge when it is missing, with the gateway of
+// the network as its address since the containers route through it
+func ensureBridge(name, gateway string) error {
+	if err := exec.Command("ip", "link", "show", name).Run(); err == nil {
+		return nil
+	}
+
+	log.Infof("bridge %s not found, create it", name)
+	if err := runIP(fmt.Sprintf("link add %s type bridge", name)); err != nil {
+		return err
+	}
+
+	if gateway != "" {
+		if err := runIP(fmt.Sprintf("addr replace %s dev %s", gateway, name)); err != nil {
+			return err
+		}
+	}
+
+	return runIP(fmt.Sprintf("link set %s up", name))
+}
+
+// gatewayCIDR is the gateway of network with the prefix length of its
+// subnet, e.g. 192.168.1.1/24. It is empty when there is no gateway.
+func gatewayCIDR(network *Network) string {
+	if _, _, err := net.ParseCIDR(network.Gateway); err == nil {
+		return network.Gateway
+	}
+
+	gateway := net.ParseIP(network.Gateway)
+	_, subnet, err := net.ParseCIDR(network.Subnet)
+	if gateway == nil || err != nil {
+		return ""
+	}
+
+	ones, _ := subnet.Mask.Size()
+	return fmt.Sprintf("%s/%d", gateway, ones)
+}
+
+// generateMacAddress builds the same kind of mac address docker does:
+// 02:42 followed by the four bytes of the IPv4 address
+func generateMacAddress(ip net.IP) string {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return ""
+	}
+
+	return net.HardwareAddr{0x02, 0x42, ip4[0], ip4[1], ip4[2], ip4[3]}.String()
+}
+
+func shortID(id string) string {
+	if len(id) > 11 {
+		return id[:11]
+	}
+
+	return id
+}
+
+func runIP(args string) error {
+	out, err := exec.Command("ip", strings.Split(args, " ")...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ip %s failed: %s %s", args, err.Error(), strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func getNetwork(networkID string) (*Network, error) {
+	network := &Network{}
+	if err := loadJSON(config.NetworkDriverNetworkStorePath(networkID), network); err != nil {
+		return nil, err
+	}
+
+	return network, nil
+}
+
+func getEndpoint(endpointID string) (*Endpoint, error) {
+	endpoint := &Endpoint{}
+	if err := loadJSON(config.NetworkDriverEndpointStorePath(endpointID), endpoint); err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+func storeJSON(key string, value interface{}) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return db.SetKey(key, string(valueBytes))
+}
+
+func loadJSON(key string, value interface{}) error {
+	valueStr, err := db.GetKey(key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(valueStr), value)
+}
@@ -0,0 +1,17 @@
+package networkdriver
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// DriverName is the name docker knows the july network driver by,
+// e.g. `docker network create -d july --ipam-driver=jdjr ...`
+const DriverName = "july"
+
+func StartServer() {
+	d := &BridgeDriver{}
+	h := NewHandler(d)
+	if err := h.ServeUnix("root", DriverName); err != nil {
+		log.Errorf("network driver server exit. Error: %s", err.Error())
+	}
+}
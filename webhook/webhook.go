@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	EventIPAllocated   = "ip.allocated"
+	EventIPReleased    = "ip.released"
+	EventDomainBound   = "domain.bound"
+	EventDomainUnbound = "domain.unbound"
+
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body
+	// keyed with the webhook secret
+	SignatureHeader = "X-July-Signature"
+	EventHeader     = "X-July-Event"
+
+	DefaultRetries = 3
+	DefaultTimeout = 10 * time.Second
+)
+
+// retryDelay is the delay before the first retry, doubled on every failure
+var retryDelay = time.Second
+
+// Endpoint posts json payloads to URL, signed with Secret when it is set.
+// Failed posts are retried Retries times with exponential backoff.
+type Endpoint struct {
+	URL     string
+	Secret  string
+	Headers map[string]string
+	Retries int
+	Timeout time.Duration
+}
+
+// Send posts body as event, it returns the error of the last attempt
+func (e *Endpoint) Send(event string, body []byte) error {
+	retries := e.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err := e.post(event, body)
+		if err == nil {
+			log.Debugf("webhook %s got %s event", e.URL, event)
+			return nil
+		}
+
+		if attempt > retries {
+			return fmt.Errorf("webhook %s dropped %s event after %d attempts: %s", e.URL, event, attempt, err.Error())
+		}
+
+		log.Warnf("webhook %s failed on %s event, retry in %s. Error: %s", e.URL, event, delay, err.Error())
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (e *Endpoint) post(event string, body []byte) error {
+	req, err := http.NewRequest("POST", e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.Headers {
+		req.Header.Set(key, value)
+	}
+
+	req.Header.Set(EventHeader, event)
+	if e.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(e.Secret, body))
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("status code %d, result %s", resp.StatusCode, string(result))
+	}
+
+	return nil
+}
+
+// Config is a webhook notified of the july events. Events filters the event
+// types sent to it, empty means all of them.
+type Config struct {
+	URL     string
+	Secret  string
+	Headers map[string]string
+	Events  []string
+	Retries int
+	Timeout time.Duration
+}
+
+type Payload struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+type IPData struct {
+	Network string `json:"network"`
+	IP      string `json:"ip"`
+}
+
+type DomainData struct {
+	ContainerID string   `json:"container_id"`
+	IP          string   `json:"ip"`
+	Domain      string   `json:"domain"`
+	Zone        string   `json:"zone"`
+	Names       []string `json:"names,omitempty"`
+}
+
+type webhook struct {
+	Endpoint
+	Events []string
+}
+
+var (
+	lock       sync.RWMutex
+	webhooks   []*webhook
+	deliveries sync.WaitGroup
+)
+
+// Setup replaces the webhooks notified by Notify
+func Setup(configs []Config) error {
+	var hooks []*webhook
+	for _, config := range configs {
+		if config.URL == "" {
+			return fmt.Errorf("webhook without url")
+		}
+
+		hooks = append(hooks, &webhook{
+			Endpoint: Endpoint{
+				URL:     config.URL,
+				Secret:  config.Secret,
+				Headers: config.Headers,
+				Retries: config.Retries,
+				Timeout: config.Timeout,
+			},
+			Events: config.Events,
+		})
+	}
+
+	lock.Lock()
+	webhooks = hooks
+	lock.Unlock()
+	return nil
+}
+
+// Notify sends event to every webhook interested in it. The deliveries run in
+// the background, so the caller is never slowed down by a webhook.
+func Notify(event string, data interface{}) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Payload{Event: event, Time: time.Now(), Data: data})
+	if err != nil {
+		log.Errorf("marshal webhook %s payload failed. Error: %s", event, err.Error())
+		return
+	}
+
+	for _, hook := range webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+
+		deliveries.Add(1)
+		go func(hook *webhook) {
+			defer deliveries.Done()
+			if err := hook.Send(event, body); err != nil {
+				log.Error(err.Error())
+			}
+		}(hook)
+	}
+}
+
+// Wait blocks until the notifications sent so far are delivered or dropped,
+// short lived processes like the cli call it before exiting
+func Wait() {
+	deliveries.Wait()
+}
+
+func (hook *webhook) wants(event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign returns the signature header value of body, receivers compute it the
+// same way to check the payload comes from july
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver records the requests posted to it, failing the first failures of
+// them with status
+type receiver struct {
+	sync.Mutex
+	server   *httptest.Server
+	requests []*http.Request
+	bodies   [][]byte
+	failures int
+	status   int
+}
+
+func startReceiver(failures, status int) *receiver {
+	r := &receiver{failures: failures, status: status}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		r.Lock()
+		defer r.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		if len(r.requests) <= r.failures {
+			w.WriteHeader(r.status)
+		}
+	}))
+
+	return r
+}
+
+func (r *receiver) count() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.requests)
+}
+
+func fastRetries(t *testing.T) {
+	delay := retryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() {
+		retryDelay = delay
+		Setup(nil)
+	})
+}
+
+func TestNotifySignature(t *testing.T) {
+	fastRetries(t)
+	r := startReceiver(0, 0)
+	defer r.server.Close()
+
+	secret := "s3cret"
+	if err := Setup([]Config{{URL: r.server.URL, Secret: secret}}); err != nil {
+		t.Fatalf("setup: %s", err)
+	}
+
+	Notify(EventIPAllocated, IPData{Network: "192.168.1.0", IP: "192.168.1.10"})
+	Wait()
+
+	if r.count() != 1 {
+		t.Fatalf("expected 1 request, got %d", r.count())
+	}
+
+	req, body := r.requests[0], r.bodies[0]
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get(SignatureHeader) != want {
+		t.Errorf("expected signature %s, got %s", want, req.Header.Get(SignatureHeader))
+	}
+
+	if req.Header.Get(EventHeader) != EventIPAllocated {
+		t.Errorf("expected event header %s, got %s", EventIPAllocated, req.Header.Get(EventHeader))
+	}
+
+	var payload struct {
+		Event string `json:"event"`
+		Data  IPData `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("unmarshal payload: %s", err)
+	}
+
+	if payload.Event != EventIPAllocated || payload.Data.IP != "192.168.1.10" {
+		t.Errorf("unexpected payload %s", body)
+	}
+}
+
+func TestNotifyUnsigned(t *testing.T) {
+	fastRetries(t)
+	r := startReceiver(0, 0)
+	defer r.server.Close()
+
+	Setup([]Config{{URL: r.server.URL}})
+	Notify(EventIPReleased, IPData{Network: "192.168.1.0", IP: "192.168.1.10"})
+	Wait()
+
+	if r.count() != 1 {
+		t.Fatalf("expected 1 request, got %d", r.count())
+	}
+
+	if signature := r.requests[0].Header.Get(SignatureHeader); signature != "" {
+		t.Errorf("webhook without secret got signature %s", signature)
+	}
+}
+
+func TestSendRetriesServerErrors(t *testing.T) {
+	fastRetries(t)
+	r := startReceiver(2, http.StatusInternalServerError)
+	defer r.server.Close()
+
+	endpoint := Endpoint{URL: r.server.URL, Retries: 3}
+	if err := endpoint.Send(EventDomainBound, []byte("{}")); err != nil {
+		t.Fatalf("send: %s", err)
+	}
+
+	if r.count() != 3 {
+		t.Errorf("expected 2 failed and 1 delivered request, got %d requests", r.count())
+	}
+}
+
+func TestSendGivesUpAfterRetries(t *testing.T) {
+	fastRetries(t)
+	r := startReceiver(10, http.StatusServiceUnavailable)
+	defer r.server.Close()
+
+	endpoint := Endpoint{URL: r.server.URL, Retries: 2}
+	if err := endpoint.Send(EventDomainBound, []byte("{}")); err == nil {
+		t.Fatal("send to a failing webhook succeeded")
+	}
+
+	if r.count() != 3 {
+		t.Errorf("expected 1 attempt and 2 retries, got %d requests", r.count())
+	}
+}
+
+func TestNotifyFiltersEvents(t *testing.T) {
+	fastRetries(t)
+	all := startReceiver(0, 0)
+	defer all.server.Close()
+	ips := startReceiver(0, 0)
+	defer ips.server.Close()
+
+	Setup([]Config{
+		{URL: all.server.URL},
+		{URL: ips.server.URL, Events: []string{EventIPAllocated, EventIPReleased}},
+	})
+
+	Notify(EventIPAllocated, IPData{IP: "192.168.1.10"})
+	Notify(EventDomainBound, DomainData{Domain: "web.example.com", IP: "192.168.1.10"})
+	Notify(EventIPReleased, IPData{IP: "192.168.1.10"})
+	Wait()
+
+	if all.count() != 3 {
+		t.Errorf("webhook without events expected 3 requests, got %d", all.count())
+	}
+
+	if ips.count() != 2 {
+		t.Fatalf("webhook of the ip events expected 2 requests, got %d", ips.count())
+	}
+
+	for _, req := range ips.requests {
+		if event := req.Header.Get(EventHeader); event == EventDomainBound {
+			t.Errorf("webhook of the ip events got %s", event)
+		}
+	}
+}